@@ -22,10 +22,22 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check-config":
+			checkConfig(os.Args[2:])
+			return
+		case "record":
+			record(os.Args[2:])
+			return
+		case "replay":
+			replay(os.Args[2:])
+			return
+		}
+	}
+
 	mqttCfg := mqtt.MustFlags(flag.String, flag.Bool)
-	flgAddress := flag.String("exporter.listen-address", "0.0.0.0:0", "address:port the exporter will listen on")
-	flgLatitude := flag.Float64("location.lat", 0.0, "latitude of location for sunrise/sunset")
-	flgLongitude := flag.Float64("location.long", 0.0, "longitude of location for sunrise/sunset")
+	cfgFlags := newConfigFlags(flag.CommandLine)
 	flgVersion := flag.Bool("version", false, "print version info and exit")
 	flag.Parse()
 
@@ -38,6 +50,11 @@ func main() {
 		os.Exit(0)
 	}
 
+	cfg, err := cfgFlags.load()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
 	m, err := mqtt.New(context.Background(), mqttCfg())
 	if err != nil {
 		log.Fatal(err.Error())
@@ -55,21 +72,112 @@ func main() {
 	}()
 
 	mg := server.New(m)
+	serve(cfg, cfgFlags.load, mg)
+}
 
+// serve runs the exporter until the process is told to stop
+func serve(cfg *sensorer.Config, load sensorer.ConfigLoader, mg *server.Manager) {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
 	log.Print("starting exporter")
-	shutdown, err := sensorer.NewServer(*flgAddress, *flgLatitude, *flgLongitude, mg)
+	srv, err := sensorer.NewServer(cfg, load, mg)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 	log.Print("started exporter")
 
-	<-stop
+loop:
+	for {
+		select {
+		case <-hup:
+			if err := srv.Reload(); err != nil {
+				log.Printf("reloading configuration failed: %v", err)
+				continue
+			}
+			log.Print("reloaded configuration")
+		case <-stop:
+			break loop
+		}
+	}
 	log.Print("shutting down exporter")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	shutdown(ctx)
+	srv.Shutdown(ctx)
 	log.Print("shutdown exporter")
 }
+
+// configFlags are the flags configuring the exporter. Flags that are
+// explicitly set take precedence over the configuration file.
+type configFlags struct {
+	fs        *flag.FlagSet
+	config    *string
+	address   *string
+	latitude  *float64
+	longitude *float64
+}
+
+// newConfigFlags defines the configuration flags on fs
+func newConfigFlags(fs *flag.FlagSet) *configFlags {
+	return &configFlags{
+		fs:        fs,
+		config:    fs.String("config", "", "path to configuration file"),
+		address:   fs.String("exporter.listen-address", "0.0.0.0:0", "address:port the exporter will listen on"),
+		latitude:  fs.Float64("location.lat", 0.0, "latitude of location for sunrise/sunset"),
+		longitude: fs.Float64("location.long", 0.0, "longitude of location for sunrise/sunset"),
+	}
+}
+
+// load reads the configuration file, if any, and applies the flags
+func (f *configFlags) load() (*sensorer.Config, error) {
+	cfg := sensorer.DefaultConfig()
+	if *f.config != "" {
+		var err error
+		cfg, err = sensorer.LoadConfig(*f.config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "exporter.listen-address":
+			cfg.ListenAddress = *f.address
+		case "location.lat":
+			cfg.Location.Latitude = *f.latitude
+		case "location.long":
+			cfg.Location.Longitude = *f.longitude
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// checkConfig validates a configuration file and exits, without connecting
+// to MQTT
+func checkConfig(args []string) {
+	fs := flag.NewFlagSet("check-config", flag.ExitOnError)
+	flgConfig := fs.String("config", "", "path to configuration file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s check-config [-config] file\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	path := *flgConfig
+	if path == "" {
+		path = fs.Arg(0)
+	}
+	if path == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if _, err := sensorer.LoadConfig(path); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stdout, "%s: configuration is valid\n", path)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"hemtjan.st/sensorer"
+	"hemtjan.st/sensorer/internal/memtransport"
+	rec "hemtjan.st/sensorer/internal/record"
+	"lib.hemtjan.st/server"
+	"lib.hemtjan.st/transport/mqtt"
+)
+
+// record writes all announcements and feature values received from MQTT
+// to a file until the process is told to stop
+func record(args []string) {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	mqttCfg := mqtt.MustFlags(fs.String, fs.Bool)
+	flgOut := fs.String("out", "", "file to record to")
+	fs.Parse(args)
+
+	if *flgOut == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Create(*flgOut)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	w := rec.NewWriter(f)
+
+	m, err := mqtt.New(context.Background(), mqttCfg())
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	go func() {
+		for {
+			ok, err := m.Start()
+			if !ok {
+				break
+			}
+			log.Printf("Error, retrying in 5 seconds: %v", err)
+			time.Sleep(5 * time.Second)
+		}
+		os.Exit(1)
+	}()
+
+	mg := server.New(rec.NewTransport(m, w))
+	ctx, cancel := context.WithCancel(context.Background())
+	go mg.Start(ctx)
+	log.Printf("recording to %s", *flgOut)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	cancel()
+
+	if err := w.Flush(); err != nil {
+		log.Fatal(err.Error())
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err.Error())
+	}
+	log.Print("stopped recording")
+}
+
+// replay feeds a recording into the exporter instead of MQTT
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	cfgFlags := newConfigFlags(fs)
+	flgIn := fs.String("in", "", "recording to replay")
+	flgSpeed := fs.Float64("speed", 1.0, "replay speed, 0 replays without delay")
+	flgKeepState := fs.Bool("keep-state", false, "use the state file of the configuration, which is ignored by default so that replayed data doesn't overwrite it")
+	fs.Parse(args)
+
+	if *flgIn == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	load := func() (*sensorer.Config, error) {
+		cfg, err := cfgFlags.load()
+		if err != nil {
+			return nil, err
+		}
+		if !*flgKeepState {
+			cfg.StateFile = ""
+		}
+		return cfg, nil
+	}
+	cfg, err := load()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	f, err := os.Open(*flgIn)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer f.Close()
+
+	t := memtransport.New()
+	mg := server.New(t)
+	go func() {
+		log.Printf("replaying %s", *flgIn)
+		if err := rec.Replay(context.Background(), f, t, *flgSpeed); err != nil {
+			log.Printf("replaying %s: %v", *flgIn, err)
+			return
+		}
+		log.Printf("replayed %s", *flgIn)
+	}()
+	serve(cfg, load, mg)
+}
@@ -0,0 +1,99 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// microgram converts µg/m³ to g/m³
+const microgram = 1e-6
+
+// airQualityFeatures are the features exported by the AirQualityCollector.
+// Densities are announced in µg/m³ and exported in g/m³.
+var airQualityFeatures = []featureSpec{
+	{
+		feature:   "carbonDioxideLevel",
+		metric:    "carbon_dioxide_ppm",
+		help:      "Carbon dioxide level in parts per million",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "carbonDioxidePeakLevel",
+		metric:    "carbon_dioxide_peak_ppm",
+		help:      "Peak carbon dioxide level in parts per million",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "carbonDioxideDetected",
+		metric:    "carbon_dioxide_detected",
+		help:      "Abnormal carbon dioxide level detected",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "carbonMonoxideLevel",
+		metric:    "carbon_monoxide_ppm",
+		help:      "Carbon monoxide level in parts per million",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "carbonMonoxideDetected",
+		metric:    "carbon_monoxide_detected",
+		help:      "Abnormal carbon monoxide level detected",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "vocDensity",
+		metric:    "voc_grams_per_cubic_meter",
+		help:      "Volatile organic compound density",
+		valueType: prometheus.GaugeValue,
+		scale:     microgram,
+	},
+	{
+		feature:   "pm10Density",
+		metric:    "pm10_grams_per_cubic_meter",
+		help:      "Particulate Matter (PM10) density",
+		valueType: prometheus.GaugeValue,
+		scale:     microgram,
+	},
+	{
+		feature:   "nitrogenDioxideDensity",
+		metric:    "nitrogen_dioxide_grams_per_cubic_meter",
+		help:      "Nitrogen dioxide density",
+		valueType: prometheus.GaugeValue,
+		scale:     microgram,
+	},
+	{
+		feature:   "ozoneDensity",
+		metric:    "ozone_grams_per_cubic_meter",
+		help:      "Ozone density",
+		valueType: prometheus.GaugeValue,
+		scale:     microgram,
+	},
+	{
+		feature:   "sulphurDioxideDensity",
+		metric:    "sulphur_dioxide_grams_per_cubic_meter",
+		help:      "Sulphur dioxide density",
+		valueType: prometheus.GaugeValue,
+		scale:     microgram,
+	},
+	{
+		feature:   "radonLevel",
+		metric:    "radon_becquerels_per_cubic_meter",
+		help:      "Radon activity concentration",
+		valueType: prometheus.GaugeValue,
+	},
+}
+
+// AirQualityCollector gets air quality data from sensors
+type AirQualityCollector struct {
+	*featureCollector
+}
+
+// NewAirQualityCollector returns a collector fetching air quality data of
+// sensors
+func NewAirQualityCollector(m DeviceLister) (prometheus.Collector, error) {
+	return &AirQualityCollector{
+		featureCollector: newFeatureCollector(m, airQualityFeatures),
+	}, nil
+}
@@ -0,0 +1,25 @@
+package collectors
+
+import (
+	"testing"
+
+	"hemtjan.st/sensorer/collectors/collectortest"
+)
+
+func TestBatteryCollector(t *testing.T) {
+	h := collectortest.New(t)
+	h.Announce("sensor/hall", "sensor", "batteryLevel")
+	h.Set("sensor/hall", "batteryLevel", "87")
+	// Devices without a value yet are not exported
+	h.Announce("sensor/attic", "sensor", "batteryLevel")
+
+	c, err := NewBatteryCollector(h.Manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_battery_level_percent Battery level in percent
+# TYPE sensors_battery_level_percent gauge
+sensors_battery_level_percent{source="sensor/hall"} 87
+`)
+}
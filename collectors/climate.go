@@ -0,0 +1,102 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lib.hemtjan.st/feature"
+	"lib.hemtjan.st/server"
+)
+
+// climateFeatures are the features exported by the ClimateCollector
+var climateFeatures = []featureSpec{
+	{
+		feature:   "targetTemperature",
+		metric:    "thermostat_target_temperature_celsius",
+		help:      "Target temperature in degrees Celsius",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "currentHeatingCoolingState",
+		metric:    "thermostat_current_mode",
+		help:      "Current heating/cooling mode",
+		valueType: prometheus.GaugeValue,
+		states:    []string{"off", "heat", "cool"},
+	},
+	{
+		feature:   "targetHeatingCoolingState",
+		metric:    "thermostat_target_mode",
+		help:      "Target heating/cooling mode",
+		valueType: prometheus.GaugeValue,
+		states:    []string{"off", "heat", "cool", "auto"},
+	},
+	{
+		feature:   "targetRelativeHumidity",
+		metric:    "humidity_target_relative_percent",
+		help:      "Target Relative Humidity in percent",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "rotationSpeed",
+		metric:    "fan_rotation_speed_percent",
+		help:      "Fan rotation speed in percent",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "currentFanState",
+		metric:    "fan_state",
+		help:      "Current fan state",
+		valueType: prometheus.GaugeValue,
+		states:    []string{"inactive", "idle", "blowing"},
+	},
+}
+
+// ClimateCollector gets data from thermostats, heaters and fans
+type ClimateCollector struct {
+	*featureCollector
+	delta *prometheus.Desc
+}
+
+// NewClimateCollector returns a collector fetching climate control data
+func NewClimateCollector(m DeviceLister) (prometheus.Collector, error) {
+	return &ClimateCollector{
+		featureCollector: newFeatureCollector(m, climateFeatures),
+		delta: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "thermostat", "delta_celsius"),
+			"Target temperature minus current temperature in degrees Celsius",
+			sourceLabels(m), nil,
+		),
+	}, nil
+}
+
+// Describe sends all metrics descriptions into the channel
+func (c *ClimateCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.featureCollector.Describe(ch)
+	ch <- c.delta
+}
+
+// Collect sends metric updates into the channel
+func (c *ClimateCollector) Collect(ch chan<- prometheus.Metric) {
+	targets := map[string]float64{}
+	devices := map[string]server.Device{}
+	c.collect(ch, func(s server.Device, ft string, v float64) {
+		if ft == "targetTemperature" {
+			targets[s.Info().Topic] = v
+			devices[s.Info().Topic] = s
+		}
+	})
+
+	// The current temperature is exported by the EnvironmentalCollector
+	for topic, target := range targets {
+		s := devices[topic]
+		ft := s.Feature(feature.CurrentTemperature.String())
+		if !ft.Exists() || ft.Value() == "" {
+			continue
+		}
+		current, err := toFloat(ft.Value())
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.delta,
+			prometheus.GaugeValue, target-current, sourceValues(c.m, s, topic)...)
+	}
+}
@@ -0,0 +1,138 @@
+// Package collectortest provides helpers to test collectors against a
+// server.Manager without an MQTT broker
+package collectortest // import "hemtjan.st/sensorer/collectors/collectortest"
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"hemtjan.st/sensorer/internal/memtransport"
+	"lib.hemtjan.st/device"
+	"lib.hemtjan.st/feature"
+	"lib.hemtjan.st/server"
+)
+
+// timeout is how long to wait for the manager to process a message
+const timeout = 5 * time.Second
+
+// Harness runs a server.Manager over an in-memory transport
+type Harness struct {
+	Manager   *server.Manager
+	Transport *memtransport.Transport
+
+	t      testing.TB
+	cancel context.CancelFunc
+}
+
+// New starts a manager over an in-memory transport. It is stopped when
+// the test ends.
+func New(t testing.TB) *Harness {
+	tr := memtransport.New()
+	mg := server.New(tr)
+	ctx, cancel := context.WithCancel(context.Background())
+	go mg.Start(ctx)
+
+	h := &Harness{
+		Manager:   mg,
+		Transport: tr,
+		t:         t,
+		cancel:    cancel,
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+// Close stops the manager
+func (h *Harness) Close() {
+	h.cancel()
+}
+
+// Announce announces a device with the given features and waits for the
+// manager to know about it
+func (h *Harness) Announce(topic, typ string, features ...string) {
+	h.t.Helper()
+	h.AnnounceInfo(&device.Info{
+		Topic: topic,
+		Name:  topic,
+		Type:  typ,
+	}, features...)
+}
+
+// AnnounceInfo announces a device with the given info and features and
+// waits for the manager to know about it
+func (h *Harness) AnnounceInfo(info *device.Info, features ...string) {
+	h.t.Helper()
+	if info.Features == nil {
+		info.Features = map[string]*feature.Info{}
+	}
+	for _, f := range features {
+		info.Features[f] = &feature.Info{
+			GetTopic: getTopic(info.Topic, f),
+		}
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.Transport.Announce(info.Topic, b)
+	h.waitFor(func() bool {
+		d := h.Manager.Device(info.Topic)
+		if d == nil || !d.Exists() {
+			return false
+		}
+		for _, f := range features {
+			if !d.Feature(f).Exists() {
+				return false
+			}
+		}
+		return true
+	}, "device %s to be announced", info.Topic)
+}
+
+// Set publishes a feature value of a device and waits for the manager to
+// receive it
+func (h *Harness) Set(topic, feature, value string) {
+	h.t.Helper()
+	h.Transport.Publish(getTopic(topic, feature), []byte(value), true)
+	h.waitFor(func() bool {
+		d := h.Manager.Device(topic)
+		return d != nil && d.Feature(feature).Value() == value
+	}, "%s %s to be %q", topic, feature, value)
+}
+
+// waitFor polls until ok returns true, and fails the test on timeout
+func (h *Harness) waitFor(ok func() bool, format string, args ...interface{}) {
+	h.t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !ok() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting for "+format, args...)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// getTopic returns the topic values of a feature are published on
+func getTopic(topic, feature string) string {
+	return topic + "/" + feature + "/get"
+}
+
+// CollectAndCompare registers the collector with a pedantic registry and
+// compares what it collects with the expected exposition text. Only the
+// given metrics are compared, or all if none are given.
+func CollectAndCompare(t testing.TB, c prometheus.Collector, expected string, metricNames ...string) {
+	t.Helper()
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(c); err != nil {
+		t.Fatalf("registering collector: %v", err)
+	}
+	if err := testutil.GatherAndCompare(r, strings.NewReader(expected), metricNames...); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,53 +1,49 @@
 package collectors
 
 import (
-	"log"
-
 	"github.com/prometheus/client_golang/prometheus"
 
 	"lib.hemtjan.st/feature"
-	"lib.hemtjan.st/server"
 )
 
-// ContactCollector gets contact state from sensors
+// contactFeatures are the features exported by the ContactCollector
+var contactFeatures = []featureSpec{
+	{
+		feature:   feature.ContactSensorState.String(),
+		metric:    "contact_state",
+		help:      "Contact state (open/closed)",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+}
+
+// ContactCollector gets contact state from sensors. Next to the current
+// state it exports the transitions the StateTracker has seen, so that a
+// door opening and closing between two scrapes is not lost.
 type ContactCollector struct {
-	contactState *prometheus.Desc
-	m            *server.Manager
+	*featureCollector
+	contact *stateMetrics
+	states  *StateTracker
 }
 
 // NewContactCollector returns a collector fetching contact sensor data
-func NewContactCollector(m *server.Manager) (prometheus.Collector, error) {
+func NewContactCollector(m DeviceLister, states *StateTracker) (prometheus.Collector, error) {
 	return &ContactCollector{
-		m: m,
-		contactState: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "contact", "state"),
-			"Contact state (open/closed)",
-			[]string{"source"}, nil,
-		),
+		featureCollector: newFeatureCollector(m, contactFeatures),
+		// A contact sensor reports 1 when the contact is not detected
+		contact: newStateMetrics(m, feature.ContactSensorState.String(), "contact", "open", "closed"),
+		states:  states,
 	}, nil
 }
 
 // Describe sends all metrics descriptions into the channel
 func (c *ContactCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- c.contactState
+	c.featureCollector.Describe(ch)
+	c.contact.describe(ch)
 }
 
 // Collect sends metric updates into the channel
 func (c *ContactCollector) Collect(ch chan<- prometheus.Metric) {
-	devices := c.m.Devices()
-	for _, s := range devices {
-		if ft := s.Feature(feature.ContactSensorState.String()); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.contactState,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-	}
+	c.featureCollector.Collect(ch)
+	c.contact.collect(ch, c.m, c.states)
 }
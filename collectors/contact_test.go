@@ -0,0 +1,82 @@
+package collectors
+
+import (
+	"testing"
+	"time"
+
+	"hemtjan.st/sensorer/collectors/collectortest"
+)
+
+func TestContactCollector(t *testing.T) {
+	h := collectortest.New(t)
+	h.Announce("sensor/door", "contactSensor", "contactSensorState")
+	h.Set("sensor/door", "contactSensorState", "0")
+
+	tracker := NewTracker(h.Manager)
+	states := NewStateTracker(tracker)
+	tracker.Sync()
+	c, err := NewContactCollector(h.Manager, states)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The door opens and closes again before the first scrape
+	h.Set("sensor/door", "contactSensorState", "1")
+	h.Set("sensor/door", "contactSensorState", "0")
+	waitForTransitions(t, states, "sensor/door", "contactSensorState", 2)
+
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_contact_state Contact state (open/closed)
+# TYPE sensors_contact_state gauge
+sensors_contact_state{source="sensor/door"} 0
+# HELP sensors_contact_transitions_total Number of state changes, by the new state
+# TYPE sensors_contact_transitions_total counter
+sensors_contact_transitions_total{source="sensor/door",to="closed"} 1
+sensors_contact_transitions_total{source="sensor/door",to="open"} 1
+`, "sensors_contact_state", "sensors_contact_transitions_total")
+}
+
+// waitForTransitions waits until the state tracker has seen n transitions
+// of a feature, as the updates reach it asynchronously
+func waitForTransitions(t *testing.T, states *StateTracker, topic, feature string, n float64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, _ := states.state(topic, feature, "")
+		if st.toActive+st.toInactive >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v transitions of %s %s", n, topic, feature)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestContactCollectorBoolean(t *testing.T) {
+	h := collectortest.New(t)
+	h.Announce("sensor/window", "contactSensor", "contactSensorState")
+	h.Set("sensor/window", "contactSensorState", "true")
+
+	tracker := NewTracker(h.Manager)
+	states := NewStateTracker(tracker)
+	tracker.Sync()
+	c, err := NewContactCollector(h.Manager, states)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Set("sensor/window", "contactSensorState", "false")
+	waitForTransitions(t, states, "sensor/window", "contactSensorState", 1)
+
+	// The state is exported next to the transition it was counted for
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_contact_state Contact state (open/closed)
+# TYPE sensors_contact_state gauge
+sensors_contact_state{source="sensor/window"} 0
+# HELP sensors_contact_transitions_total Number of state changes, by the new state
+# TYPE sensors_contact_transitions_total counter
+sensors_contact_transitions_total{source="sensor/window",to="closed"} 1
+sensors_contact_transitions_total{source="sensor/window",to="open"} 0
+`, "sensors_contact_state", "sensors_contact_transitions_total")
+}
@@ -0,0 +1,263 @@
+package collectors
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lib.hemtjan.st/feature"
+	"lib.hemtjan.st/server"
+)
+
+// counterFeatures are the cumulative features whose resets the
+// CounterTracker detects
+var counterFeatures = []string{
+	feature.EnergyUsed.String(),
+	"energyProduced",
+	"waterUsed",
+	"waterUsedLiters",
+	"gasUsed",
+	"heatEnergyUsed",
+}
+
+// CounterPolicy is how the values of a cumulative feature are exported
+type CounterPolicy string
+
+// Counter policies
+const (
+	// CounterPassthrough exports the values as reported by the device
+	CounterPassthrough CounterPolicy = "passthrough"
+	// CounterMonotonic adds an offset to the values after a reset, so
+	// that the counter continues where it was
+	CounterMonotonic CounterPolicy = "monotonic"
+	// CounterIgnoreDecrease exports the highest value reported so far
+	CounterIgnoreDecrease CounterPolicy = "ignore-decrease"
+)
+
+// Valid returns true if p is a known policy
+func (p CounterPolicy) Valid() bool {
+	switch p {
+	case CounterPassthrough, CounterMonotonic, CounterIgnoreDecrease:
+		return true
+	}
+	return false
+}
+
+// CounterPolicies is implemented by device listers that configure how
+// cumulative features are exported. Features of other device listers use
+// CounterMonotonic.
+type CounterPolicies interface {
+	// CounterPolicy returns the policy of the given feature
+	CounterPolicy(feature string) CounterPolicy
+}
+
+// counterPolicy returns the policy of a feature of the devices of m
+func counterPolicy(m DeviceLister, feature string) CounterPolicy {
+	if p, ok := m.(CounterPolicies); ok {
+		return p.CounterPolicy(feature)
+	}
+	return CounterMonotonic
+}
+
+// counterState is the state of a cumulative feature
+type counterState struct {
+	// Last is the last value reported by the device and Serial the serial
+	// number of the device that reported it
+	Last   float64 `json:"last"`
+	Serial string  `json:"serial,omitempty"`
+	// Offset is added to the reported value, so that the exported counter
+	// continues where it was before the device was reset or replaced
+	Offset float64 `json:"offset"`
+	// Highest is the highest value reported so far
+	Highest float64 `json:"highest"`
+	// Resets counts the resets and replacements
+	Resets float64 `json:"resets"`
+}
+
+// export returns the value of the exported counter for the value v the
+// device reported last
+func (s counterState) export(p CounterPolicy, v float64) float64 {
+	switch p {
+	case CounterPassthrough:
+		return v
+	case CounterIgnoreDecrease:
+		return s.Highest
+	}
+	return s.Offset + s.Last
+}
+
+// CounterTracker follows cumulative features, like meter readings, and
+// keeps the counters exported for them from going backwards when a device
+// restarts from 0, a meter rolls over or is replaced. It gets every update
+// from a Tracker, so a reset isn't lost when the counter has passed its old
+// value by the next scrape.
+type CounterTracker struct {
+	mu       sync.Mutex
+	features map[string]bool
+	counters map[stateKey]*counterState
+}
+
+// NewCounterTracker returns a CounterTracker following the updates of t
+func NewCounterTracker(t *Tracker) *CounterTracker {
+	c := &CounterTracker{
+		features: map[string]bool{},
+		counters: map[stateKey]*counterState{},
+	}
+	for _, f := range counterFeatures {
+		c.features[f] = true
+	}
+	t.OnUpdate(func(d server.Device, feature, value string, t time.Time) {
+		if !c.features[feature] {
+			return
+		}
+		v, err := toFloat(value)
+		if err != nil {
+			return
+		}
+		c.value(d.Info().Topic, d.Info().SerialNumber, feature, v)
+	})
+	return c
+}
+
+// tracks returns true if the tracker follows the given feature
+func (c *CounterTracker) tracks(feature string) bool {
+	return c.features[feature]
+}
+
+// value records a value reported by a device and returns the state of the
+// counter.
+//
+// A value below half of the last one means the device restarted from 0 or
+// the meter rolled over, and is counted as a reset. A smaller decrease is
+// taken for a glitch and otherwise ignored. A different serial number means
+// the meter was replaced, in which case the counter continues from the last
+// value of the old meter.
+func (c *CounterTracker) value(topic, serial, feature string, v float64) counterState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := stateKey{topic: topic, feature: feature}
+	st, ok := c.counters[key]
+	if !ok {
+		st = &counterState{Last: v, Serial: serial, Highest: v}
+		c.counters[key] = st
+		return *st
+	}
+	switch {
+	case serial != st.Serial:
+		st.Offset += st.Last - v
+		st.Resets++
+	case v < st.Last/2:
+		st.Offset += st.Last
+		st.Resets++
+	case v < st.Last:
+		return *st
+	}
+	st.Last = v
+	st.Serial = serial
+	if v > st.Highest {
+		st.Highest = v
+	}
+	return *st
+}
+
+// resets returns the number of resets of a feature
+func (c *CounterTracker) resets(topic, feature string) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.counters[stateKey{topic: topic, feature: feature}]
+	if !ok {
+		return 0, false
+	}
+	return st.Resets, true
+}
+
+// savedCounter is a counter as it is saved by the CounterTracker
+type savedCounter struct {
+	Topic   string `json:"topic"`
+	Feature string `json:"feature"`
+	counterState
+}
+
+// MarshalJSON returns the state of all counters, so that it can be saved
+// across restarts
+func (c *CounterTracker) MarshalJSON() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	saved := make([]savedCounter, 0, len(c.counters))
+	for k, st := range c.counters {
+		saved = append(saved, savedCounter{Topic: k.topic, Feature: k.feature, counterState: *st})
+	}
+	sort.Slice(saved, func(i, j int) bool {
+		if saved[i].Topic != saved[j].Topic {
+			return saved[i].Topic < saved[j].Topic
+		}
+		return saved[i].Feature < saved[j].Feature
+	})
+	return json.Marshal(saved)
+}
+
+// UnmarshalJSON restores the state of counters saved by MarshalJSON.
+// Counters the tracker already follows are replaced.
+func (c *CounterTracker) UnmarshalJSON(b []byte) error {
+	var saved []savedCounter
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range saved {
+		st := s.counterState
+		c.counters[stateKey{topic: s.Topic, feature: s.Feature}] = &st
+	}
+	return nil
+}
+
+// CounterCollector exports the number of resets of cumulative features
+type CounterCollector struct {
+	resets   *prometheus.Desc
+	m        DeviceLister
+	counters *CounterTracker
+}
+
+// NewCounterCollector returns a collector exporting the resets detected by
+// counters
+func NewCounterCollector(m DeviceLister, counters *CounterTracker) (prometheus.Collector, error) {
+	return &CounterCollector{
+		m:        m,
+		counters: counters,
+		resets: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "counter", "resets_total"),
+			"Number of times the counter of a feature was reset or its meter replaced",
+			append(sourceLabels(m), "feature"), nil,
+		),
+	}, nil
+}
+
+// Describe sends all metrics descriptions into the channel
+func (c *CounterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.resets
+}
+
+// Collect sends metric updates into the channel
+func (c *CounterCollector) Collect(ch chan<- prometheus.Metric) {
+	devices := c.m.Devices()
+	for _, s := range devices {
+		topic := s.Info().Topic
+		for _, name := range counterFeatures {
+			if !s.Feature(name).Exists() {
+				continue
+			}
+			resets, ok := c.counters.resets(topic, name)
+			if !ok {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.resets,
+				prometheus.CounterValue, resets,
+				append(sourceValues(c.m, s, topic), name)...)
+		}
+	}
+}
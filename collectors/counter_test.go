@@ -0,0 +1,110 @@
+package collectors
+
+import (
+	"testing"
+)
+
+func TestCounterTracker(t *testing.T) {
+	type reading struct {
+		serial string
+		value  float64
+	}
+	tests := []struct {
+		name     string
+		policy   CounterPolicy
+		readings []reading
+		expected []float64
+		resets   float64
+	}{
+		{
+			name:     "monotonic restart from 0",
+			policy:   CounterMonotonic,
+			readings: []reading{{"a", 100}, {"a", 150}, {"a", 10}, {"a", 20}},
+			expected: []float64{100, 150, 160, 170},
+			resets:   1,
+		},
+		{
+			name:     "monotonic rollover",
+			policy:   CounterMonotonic,
+			readings: []reading{{"a", 99990}, {"a", 99998}, {"a", 3}, {"a", 7}},
+			expected: []float64{99990, 99998, 100001, 100005},
+			resets:   1,
+		},
+		{
+			name:     "monotonic glitch and recovery",
+			policy:   CounterMonotonic,
+			readings: []reading{{"a", 100}, {"a", 150}, {"a", 140}, {"a", 155}},
+			expected: []float64{100, 150, 150, 155},
+			resets:   0,
+		},
+		{
+			name:     "monotonic replaced meter",
+			policy:   CounterMonotonic,
+			readings: []reading{{"a", 100}, {"a", 150}, {"b", 5}, {"b", 10}},
+			expected: []float64{100, 150, 150, 155},
+			resets:   1,
+		},
+		{
+			name:     "ignore-decrease restart from 0",
+			policy:   CounterIgnoreDecrease,
+			readings: []reading{{"a", 100}, {"a", 150}, {"a", 10}, {"a", 200}},
+			expected: []float64{100, 150, 150, 200},
+			resets:   1,
+		},
+		{
+			name:     "ignore-decrease glitch and recovery",
+			policy:   CounterIgnoreDecrease,
+			readings: []reading{{"a", 100}, {"a", 150}, {"a", 140}, {"a", 155}},
+			expected: []float64{100, 150, 150, 155},
+			resets:   0,
+		},
+		{
+			name:     "passthrough restart from 0",
+			policy:   CounterPassthrough,
+			readings: []reading{{"a", 100}, {"a", 150}, {"a", 10}, {"a", 20}},
+			expected: []float64{100, 150, 10, 20},
+			resets:   1,
+		},
+		{
+			name:     "passthrough glitch and recovery",
+			policy:   CounterPassthrough,
+			readings: []reading{{"a", 100}, {"a", 150}, {"a", 140}, {"a", 155}},
+			expected: []float64{100, 150, 140, 155},
+			resets:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCounterTracker(NewTracker(nil))
+			for i, r := range tt.readings {
+				st := c.value("power/meter", r.serial, "energyUsed", r.value)
+				if got := st.export(tt.policy, r.value); got != tt.expected[i] {
+					t.Errorf("reading %d (%v): exported %v, expected %v", i, r.value, got, tt.expected[i])
+				}
+			}
+			if resets, _ := c.resets("power/meter", "energyUsed"); resets != tt.resets {
+				t.Errorf("%v resets, expected %v", resets, tt.resets)
+			}
+		})
+	}
+}
+
+func TestCounterTrackerRestore(t *testing.T) {
+	c := NewCounterTracker(NewTracker(nil))
+	c.value("power/meter", "a", "energyUsed", 150)
+	c.value("power/meter", "a", "energyUsed", 10)
+	b, err := c.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewCounterTracker(NewTracker(nil))
+	if err := restored.UnmarshalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	// The offset survives the restart
+	st := restored.value("power/meter", "a", "energyUsed", 20)
+	if got := st.export(CounterMonotonic, 20); got != 170 {
+		t.Errorf("exported %v after restoring, expected 170", got)
+	}
+}
@@ -2,7 +2,6 @@ package collectors
 
 import (
 	"fmt"
-	"log"
 	"math"
 	"strings"
 	"time"
@@ -14,110 +13,120 @@ import (
 	"lib.hemtjan.st/server"
 )
 
+// environmentalFeatures are the features exported by the
+// EnvironmentalCollector
+var environmentalFeatures = []featureSpec{
+	{
+		feature:   feature.CurrentRelativeHumidity.String(),
+		metric:    "humidity_relative_percent",
+		help:      "Relative Humidity in percent",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   feature.CurrentTemperature.String(),
+		metric:    "temperature_celsius",
+		help:      "Temperature in degrees Celsius",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "precipitation",
+		metric:    "precipitation_mm_per_hour",
+		help:      "Precipitation rate",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "airPressure",
+		metric:    "air_pressure_hpa",
+		help:      "Atmospheric pressure",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "windSpeed",
+		metric:    "wind_speed_meters_per_second",
+		help:      "Wind Speed",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "windDirection",
+		metric:    "wind_direction_degrees",
+		help:      "Wind Direction",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "globalRadiation",
+		metric:    "global_radiation_watts_per_square_meter",
+		help:      "Global Radiation",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "pm2_5Density",
+		metric:    "pm25_microgram_per_square_meter",
+		help:      "Particulate Matter (PM2.5)",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "airQuality",
+		metric:    "air_quality",
+		help:      "Air Quality Index",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "waterLevel",
+		metric:    "water_level_percent",
+		help:      "Water Level",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "currentAmbientLightLevel",
+		metric:    "lumen_per_square_meter",
+		help:      "Light Level (Lux)",
+		valueType: prometheus.GaugeValue,
+	},
+}
+
 // EnvironmentalCollector collects sensor data from environmental sensors
 type EnvironmentalCollector struct {
-	humiture         *prometheus.Desc
-	relativeHumidity *prometheus.Desc
-	temperature      *prometheus.Desc
-	daylight         *prometheus.Desc
-	sunrise          *prometheus.Desc
-	sunset           *prometheus.Desc
-	precipitation    *prometheus.Desc
-	airPressure      *prometheus.Desc
-	windSpeed        *prometheus.Desc
-	windDirection    *prometheus.Desc
-	globalRadiation  *prometheus.Desc
-	pm25             *prometheus.Desc
-	airQuality       *prometheus.Desc
-	waterLevel       *prometheus.Desc
-	lightLevel       *prometheus.Desc
+	*featureCollector
+	humiture *prometheus.Desc
+	psychro  *psychrometrics
+	feels    *feelsLike
+	daylight *prometheus.Desc
+	sunrise  *prometheus.Desc
+	sunset   *prometheus.Desc
 
-	m    *server.Manager
 	lat  float64
 	long float64
 }
 
 // NewEnvironmentalCollector returns a new collector for gather sensor
 // metrics from environmental sensors
-func NewEnvironmentalCollector(m *server.Manager, lat, long float64) (prometheus.Collector, error) {
+func NewEnvironmentalCollector(m DeviceLister, lat, long float64) (prometheus.Collector, error) {
+	labels := sourceLabels(m)
 	return &EnvironmentalCollector{
-		m:    m,
-		lat:  lat,
-		long: long,
+		featureCollector: newFeatureCollector(m, environmentalFeatures),
+		lat:              lat,
+		long:             long,
+		psychro:          newPsychrometrics(m),
+		feels:            newFeelsLike(m),
 		humiture: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "humiture_celsius"),
 			"Heat Index ('feels like temperature') in degrees Celsius",
-			[]string{"source"}, nil,
-		),
-		relativeHumidity: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "humidity", "relative_percent"),
-			"Relative Humidity in percent",
-			[]string{"source"}, nil,
-		),
-		temperature: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "temperature_celsius"),
-			"Temperature in degrees Celsius",
-			[]string{"source"}, nil,
+			labels, nil,
 		),
 		daylight: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "daylight"),
 			"Between sunrise and sunset",
-			[]string{"source"}, nil,
+			labels, nil,
 		),
 		sunrise: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "sunrise_time_seconds"),
 			"Time the sun will rise today (UTC)",
-			[]string{"source"}, nil,
+			labels, nil,
 		),
 		sunset: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "sunset_time_seconds"),
 			"Time the sun will set today (UTC)",
-			[]string{"source"}, nil,
-		),
-		precipitation: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "precipitation_mm_per_hour"),
-			"Precipitation rate",
-			[]string{"source"}, nil,
-		),
-		airPressure: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "air_pressure_hpa"),
-			"Atmospheric pressure",
-			[]string{"source"}, nil,
-		),
-		windSpeed: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "wind_speed_meters_per_second"),
-			"Wind Speed",
-			[]string{"source"}, nil,
-		),
-		windDirection: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "wind_direction_degrees"),
-			"Wind Direction",
-			[]string{"source"}, nil,
-		),
-		globalRadiation: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "global_radiation_watts_per_square_meter"),
-			"Global Radiation",
-			[]string{"source"}, nil,
-		),
-		pm25: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "pm25_microgram_per_square_meter"),
-			"Particulate Matter (PM2.5)",
-			[]string{"source"}, nil,
-		),
-		airQuality: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "air_quality"),
-			"Air Quality Index",
-			[]string{"source"}, nil,
-		),
-		waterLevel: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "water_level_percent"),
-			"Water Level",
-			[]string{"source"}, nil,
-		),
-		lightLevel: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "lumen_per_square_meter"),
-			"Light Level (Lux)",
-			[]string{"source"}, nil,
+			labels, nil,
 		),
 	}, nil
 }
@@ -125,180 +134,46 @@ func NewEnvironmentalCollector(m *server.Manager, lat, long float64) (prometheus
 // Describe sends all metrics descriptions into the channel
 func (c *EnvironmentalCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.humiture
-	ch <- c.relativeHumidity
-	ch <- c.temperature
+	c.psychro.describe(ch)
+	c.feels.describe(ch)
+	c.featureCollector.Describe(ch)
 	ch <- c.daylight
 	ch <- c.sunrise
 	ch <- c.sunset
-	ch <- c.precipitation
-	ch <- c.airPressure
-	ch <- c.windSpeed
-	ch <- c.windDirection
-	ch <- c.globalRadiation
-	ch <- c.pm25
-	ch <- c.airQuality
-	ch <- c.waterLevel
-	ch <- c.lightLevel
 }
 
 // Collect sends metric updates into the channel
 func (c *EnvironmentalCollector) Collect(ch chan<- prometheus.Metric) {
-	devices := c.m.Devices()
+	devices := map[string]server.Device{}
 	humidity := map[string]float64{}
 	temperature := map[string]float64{}
-
-	for _, s := range devices {
-		if ft := s.Feature(feature.CurrentRelativeHumidity.String()); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			humidity[s.Info().Topic] = vf
-			ch <- prometheus.MustNewConstMetric(c.relativeHumidity,
-				prometheus.GaugeValue, vf, s.Info().Topic)
+	windSpeed := map[string]float64{}
+
+	c.collect(ch, func(s server.Device, ft string, v float64) {
+		devices[s.Info().Topic] = s
+		switch ft {
+		case feature.CurrentRelativeHumidity.String():
+			humidity[s.Info().Topic] = v
+		case feature.CurrentTemperature.String():
+			temperature[s.Info().Topic] = v
+		case "windSpeed":
+			windSpeed[s.Info().Topic] = v
 		}
-		if ft := s.Feature(feature.CurrentTemperature.String()); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			temperature[s.Info().Topic] = vf
-			ch <- prometheus.MustNewConstMetric(c.temperature,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("precipitation"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.precipitation,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("airPressure"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.airPressure,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("windSpeed"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.windSpeed,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("windDirection"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.windDirection,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("globalRadiation"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.globalRadiation,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("pm2_5Density"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.pm25,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("airQuality"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.airQuality,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("waterLevel"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.waterLevel,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("currentAmbientLightLevel"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.lightLevel,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-	}
+	})
 
 	for dev, temp := range temperature {
 		if hum, ok := humidity[dev]; ok {
 			ch <- prometheus.MustNewConstMetric(c.humiture,
-				prometheus.GaugeValue, humiture(temp, hum), fmt.Sprintf("sensor/humiture/%s", strings.TrimPrefix(dev, "sensor/")))
+				prometheus.GaugeValue, humiture(temp, hum), sourceValues(c.m, devices[dev],
+					fmt.Sprintf("sensor/humiture/%s", strings.TrimPrefix(dev, "sensor/")))...)
+			c.psychro.collect(ch, sourceValues(c.m, devices[dev], dev), temp, hum)
+		}
+		if wind, ok := windSpeed[dev]; ok {
+			labels := sourceValues(c.m, devices[dev], dev)
+			c.feels.collectWindChill(ch, labels, temp, wind)
+			if hum, ok := humidity[dev]; ok {
+				c.feels.collect(ch, labels, temp, hum, wind)
+			}
 		}
 	}
 
@@ -320,47 +195,54 @@ func (c *EnvironmentalCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(c.sunrise,
 		prometheus.GaugeValue, float64(
 			sunriseT.Unix(),
-		), "sensor/astrotime")
+		), sourceValues(c.m, nil, "sensor/astrotime")...)
 
 	ch <- prometheus.MustNewConstMetric(c.sunset,
 		prometheus.GaugeValue, float64(
 			sunsetT.Unix(),
-		), "sensor/astrotime")
+		), sourceValues(c.m, nil, "sensor/astrotime")...)
 
 	if t.After(sunriseT) && t.Before(sunsetT) {
 		ch <- prometheus.MustNewConstMetric(c.daylight,
-			prometheus.GaugeValue, 1.0, "sensor/astrotime")
+			prometheus.GaugeValue, 1.0, sourceValues(c.m, nil, "sensor/astrotime")...)
 	} else {
 		ch <- prometheus.MustNewConstMetric(c.daylight,
-			prometheus.GaugeValue, 0.0, "sensor/astrotime")
+			prometheus.GaugeValue, 0.0, sourceValues(c.m, nil, "sensor/astrotime")...)
 	}
 }
 
-// humiture returns the Heat Index in degrees Celsius.
-// This is also known as the "feels like" temperatue,
-// "felt air temperature" or "apparent temperature".
-// https://en.wikipedia.org/wiki/Heat_index
+// heatIndexMinTemp is the lowest temperature the heat index is defined for
+const heatIndexMinTemp = 26.7 // °C, 80 °F
+
+// humiture returns the Heat Index in degrees Celsius, using the algorithm of
+// the US National Weather Service. This is also known as the "feels like"
+// temperature, "felt air temperature" or "apparent temperature".
+//
+// The heat index is only defined from 26.7 °C (80 °F), below which the air
+// temperature is returned. From there Steadman's simple formula is used,
+// unless the average of its result and the air temperature is 80 °F or more,
+// in which case the Rothfusz regression is used, with the NWS adjustments for
+// low and high humidity. The regression was fitted to temperatures up to
+// 43 °C (110 °F); values beyond are extrapolated.
+// https://www.wpc.ncep.noaa.gov/html/heatindex_equation.shtml
 func humiture(temp, relativeHumidity float64) float64 {
-	c1 := -8.784695
-	c2 := 1.61139411
-	c3 := 2.33854900
-	c4 := -0.14611605
-	c5 := -0.01230809
-	c6 := -0.01642482
-	c7 := 0.00221173
-	c8 := 0.00072546
-	c9 := -0.00000358
-
-	if temp >= 26.0 {
-		return (c1 + (c2 * temp) +
-			(c3 * relativeHumidity) +
-			(c4 * temp * relativeHumidity) +
-			(c5 * math.Pow(temp, 2)) +
-			(c6 * math.Pow(relativeHumidity, 2)) +
-			(c7 * math.Pow(temp, 2) * relativeHumidity) +
-			(c8 * temp * math.Pow(relativeHumidity, 2)) +
-			(c9 * math.Pow(temp, 2) * math.Pow(relativeHumidity, 2)))
+	if temp < heatIndexMinTemp {
+		return temp
 	}
-
-	return 0.5 * (temp + 16.1 + ((temp - 21) * 1.2) + (relativeHumidity * 0.094))
+	t := temp*9/5 + 32
+	rh := relativeHumidity
+
+	hi := 0.5 * (t + 61.0 + ((t - 68.0) * 1.2) + (rh * 0.094))
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh -
+			0.22475541*t*rh - 0.00683783*t*t - 0.05481717*rh*rh +
+			0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+		switch {
+		case rh < 13 && t >= 80 && t <= 112:
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		case rh > 85 && t >= 80 && t <= 87:
+			hi += (rh - 85) / 10 * (87 - t) / 5
+		}
+	}
+	return (hi - 32) * 5 / 9
 }
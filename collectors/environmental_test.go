@@ -0,0 +1,106 @@
+package collectors
+
+import (
+	"math"
+	"testing"
+
+	"hemtjan.st/sensorer/collectors/collectortest"
+)
+
+func TestEnvironmentalCollector(t *testing.T) {
+	h := collectortest.New(t)
+	h.Announce("sensor/bedroom", "sensor", "currentTemperature", "currentRelativeHumidity")
+	h.Set("sensor/bedroom", "currentTemperature", "20")
+	h.Set("sensor/bedroom", "currentRelativeHumidity", "45")
+	h.Announce("sensor/balcony", "sensor", "currentTemperature")
+	h.Set("sensor/balcony", "currentTemperature", "-3.5")
+
+	c, err := NewEnvironmentalCollector(h.Manager, 59.33, 18.06)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_humidity_relative_percent Relative Humidity in percent
+# TYPE sensors_humidity_relative_percent gauge
+sensors_humidity_relative_percent{source="sensor/bedroom"} 45
+# HELP sensors_humiture_celsius Heat Index ('feels like temperature') in degrees Celsius
+# TYPE sensors_humiture_celsius gauge
+sensors_humiture_celsius{source="sensor/humiture/bedroom"} 20
+# HELP sensors_temperature_celsius Temperature in degrees Celsius
+# TYPE sensors_temperature_celsius gauge
+sensors_temperature_celsius{source="sensor/balcony"} -3.5
+sensors_temperature_celsius{source="sensor/bedroom"} 20
+`, "sensors_humidity_relative_percent", "sensors_humiture_celsius", "sensors_temperature_celsius")
+}
+
+func TestHumiture(t *testing.T) {
+	// Expected values in °F are from the NWS heat index chart, and for
+	// humidities below 40 % from the heat index table of NWS Technical
+	// Attachment SR 90-23. The regression is accurate to about 1 °F.
+	tests := []struct {
+		name     string
+		tempF    float64
+		rh       float64
+		expected float64
+	}{
+		{"below 80 °F", 70, 50, 69},
+		{"below 80 °F humid", 75, 50, 75},
+		{"simple formula", 80, 40, 80},
+		{"regression", 90, 50, 95},
+		{"regression humid", 90, 70, 106},
+		{"regression hot", 100, 40, 109},
+		{"regression hot and humid", 96, 65, 121},
+		{"extrapolated", 104, 55, 137},
+		{"low humidity adjustment", 90, 0, 83},
+		{"low humidity adjustment at 95 °F", 95, 0, 87},
+		{"low humidity adjustment hot", 100, 10, 95},
+		{"high humidity adjustment", 84, 95, 100},
+		{"high humidity adjustment saturated", 84, 100, 103},
+		{"high humidity adjustment at 86 °F", 86, 90, 105},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temp := (tt.tempF - 32) * 5 / 9
+			got := humiture(temp, tt.rh)*9/5 + 32
+			if math.Abs(got-tt.expected) > 1 {
+				t.Errorf("humiture(%.2f °C, %v%%) = %.1f °F, expected %v °F",
+					temp, tt.rh, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEnvironmentalCollectorInvalidValue(t *testing.T) {
+	h := collectortest.New(t)
+	for _, topic := range []string{"weather/garbage", "weather/empty"} {
+		h.Announce(topic, "weatherStation",
+			"currentTemperature", "precipitation", "airPressure", "windSpeed")
+		h.Set(topic, "currentTemperature", "12.5")
+		h.Set(topic, "airPressure", "1013.2")
+		h.Set(topic, "windSpeed", "3.4")
+	}
+	h.Set("weather/garbage", "precipitation", "n/a")
+	h.Set("weather/empty", "precipitation", "")
+
+	c, err := NewEnvironmentalCollector(h.Manager, 59.33, 18.06)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The precipitation can't be parsed, the other features of the devices
+	// are still exported
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_air_pressure_hpa Atmospheric pressure
+# TYPE sensors_air_pressure_hpa gauge
+sensors_air_pressure_hpa{source="weather/empty"} 1013.2
+sensors_air_pressure_hpa{source="weather/garbage"} 1013.2
+# HELP sensors_temperature_celsius Temperature in degrees Celsius
+# TYPE sensors_temperature_celsius gauge
+sensors_temperature_celsius{source="weather/empty"} 12.5
+sensors_temperature_celsius{source="weather/garbage"} 12.5
+# HELP sensors_wind_speed_meters_per_second Wind Speed
+# TYPE sensors_wind_speed_meters_per_second gauge
+sensors_wind_speed_meters_per_second{source="weather/empty"} 3.4
+sensors_wind_speed_meters_per_second{source="weather/garbage"} 3.4
+`, "sensors_air_pressure_hpa", "sensors_precipitation_mm_per_hour",
+		"sensors_temperature_celsius", "sensors_wind_speed_meters_per_second")
+}
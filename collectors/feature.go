@@ -0,0 +1,174 @@
+package collectors
+
+import (
+	"log"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lib.hemtjan.st/server"
+)
+
+// featureSpec describes how a Hemtjänst feature is exported as a metric.
+// Supporting a new feature only requires adding a featureSpec to the table
+// of the collector it belongs to.
+type featureSpec struct {
+	// feature is the name of the feature as announced by the device
+	feature string
+	// metric is the name of the metric, without the namespace
+	metric    string
+	help      string
+	valueType prometheus.ValueType
+	// labels are added to every sample, next to the source label. They
+	// tell apart the specs exporting the same metric, like the phases of
+	// a power meter.
+	labels prometheus.Labels
+	// scale converts the value to the unit of the metric, if set
+	scale float64
+	// binary marks features that can be reported as booleans
+	binary bool
+	// states turns an enumerated feature into a state set. The value is
+	// the index of the state, which is exported as one series per state
+	// with the state label set, of which the current one is 1.
+	states []string
+}
+
+// parse parses a value of the feature. Booleans are only accepted for
+// binary features.
+func (s featureSpec) parse(v string) (float64, error) {
+	if s.binary {
+		return toBinary(v)
+	}
+	return toFloat(v)
+}
+
+// featureCollector exports the features in specs for every device that
+// announces them
+type featureCollector struct {
+	specs []featureSpec
+	// descs and labels hold the description and the names of the spec
+	// labels of every spec. Specs exporting the same metric share a
+	// description.
+	descs  []*prometheus.Desc
+	labels [][]string
+	m      DeviceLister
+	// counters, if set, applies the counter policy to the features it
+	// tracks
+	counters *CounterTracker
+}
+
+// newFeatureCollector returns a collector walking the given feature specs.
+// Specs exporting the same metric must agree on its help and on whether it
+// is a state set. Spec labels become variable labels of the metric, which
+// are left empty for the specs that don't set them.
+func newFeatureCollector(m DeviceLister, specs []featureSpec) *featureCollector {
+	names := map[string][]string{}
+	seen := map[string]bool{}
+	for _, s := range specs {
+		for k := range s.labels {
+			if !seen[s.metric+"/"+k] {
+				seen[s.metric+"/"+k] = true
+				names[s.metric] = append(names[s.metric], k)
+			}
+		}
+	}
+	for _, labels := range names {
+		sort.Strings(labels)
+	}
+
+	descs := map[string]*prometheus.Desc{}
+	c := &featureCollector{
+		specs:  specs,
+		descs:  make([]*prometheus.Desc, 0, len(specs)),
+		labels: make([][]string, 0, len(specs)),
+		m:      m,
+	}
+	for _, s := range specs {
+		labels := names[s.metric]
+		d, ok := descs[s.metric]
+		if !ok {
+			variable := append(sourceLabels(m), labels...)
+			if len(s.states) > 0 {
+				variable = append(variable, "state")
+			}
+			d = prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "", s.metric),
+				s.help,
+				variable, nil,
+			)
+			descs[s.metric] = d
+		}
+		c.descs = append(c.descs, d)
+		c.labels = append(c.labels, labels)
+	}
+	return c
+}
+
+// Describe sends all metrics descriptions into the channel
+func (c *featureCollector) Describe(ch chan<- *prometheus.Desc) {
+	seen := map[*prometheus.Desc]bool{}
+	for _, d := range c.descs {
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		ch <- d
+	}
+}
+
+// Collect sends metric updates into the channel
+func (c *featureCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(ch, nil)
+}
+
+// collect sends metric updates into the channel and calls observe, if set,
+// for every value that was exported
+func (c *featureCollector) collect(ch chan<- prometheus.Metric, observe func(s server.Device, feature string, v float64)) {
+	devices := c.m.Devices()
+	for _, s := range devices {
+		// Every feature is handled on its own so that a feature without
+		// a usable value doesn't hide the other features of the device
+		for i, spec := range c.specs {
+			ft := s.Feature(spec.feature)
+			if !ft.Exists() {
+				continue
+			}
+			v := ft.Value()
+			if v == "" {
+				continue
+			}
+			vf, err := spec.parse(v)
+			if err != nil {
+				log.Printf("%s: %s: %s", s.Info().Topic, spec.feature, err.Error())
+				continue
+			}
+			if c.counters != nil && c.counters.tracks(spec.feature) {
+				st := c.counters.value(s.Info().Topic, s.Info().SerialNumber, spec.feature, vf)
+				vf = st.export(counterPolicy(c.m, spec.feature), vf)
+			}
+			if spec.scale != 0 {
+				vf *= spec.scale
+			}
+			if observe != nil {
+				observe(s, spec.feature, vf)
+			}
+			labels := sourceValues(c.m, s, s.Info().Topic)
+			for _, k := range c.labels[i] {
+				labels = append(labels, spec.labels[k])
+			}
+			if len(spec.states) > 0 {
+				for state, name := range spec.states {
+					current := 0.0
+					if vf == float64(state) {
+						current = 1.0
+					}
+					ch <- prometheus.MustNewConstMetric(c.descs[i],
+						spec.valueType, current, append(labels, name)...)
+				}
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.descs[i],
+				spec.valueType, vf, labels...)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package collectors
+
+import (
+	"testing"
+)
+
+// findSpec returns the spec of a feature in specs
+func findSpec(t *testing.T, specs []featureSpec, feature string) featureSpec {
+	t.Helper()
+	for _, s := range specs {
+		if s.feature == feature {
+			return s
+		}
+	}
+	t.Fatalf("no spec for %s", feature)
+	return featureSpec{}
+}
+
+func TestFeatureSpecParseBinary(t *testing.T) {
+	specs := []featureSpec{
+		contactFeatures[0],
+		findSpec(t, safetyFeatures, "smokeDetected"),
+		findSpec(t, safetyFeatures, "leakDetected"),
+		findSpec(t, safetyFeatures, "motionDetected"),
+		findSpec(t, safetyFeatures, "occupancyDetected"),
+		findSpec(t, safetyFeatures, "statusTampered"),
+		findSpec(t, lightFeatures, "on"),
+		findSpec(t, lightFeatures, "outletInUse"),
+	}
+	values := map[string]float64{"true": 1, "false": 0, "1": 1, "0": 0}
+	for _, spec := range specs {
+		for v, expected := range values {
+			got, err := spec.parse(v)
+			if err != nil {
+				t.Errorf("%s: parsing %q: %v", spec.feature, v, err)
+				continue
+			}
+			if got != expected {
+				t.Errorf("%s: parsing %q = %v, expected %v", spec.feature, v, got, expected)
+			}
+		}
+	}
+}
+
+func TestFeatureSpecParseNotBinary(t *testing.T) {
+	specs := []featureSpec{
+		// State sets have more than two states, a boolean can't tell
+		// which one is meant
+		findSpec(t, positionFeatures, "positionState"),
+		findSpec(t, positionFeatures, "lockCurrentState"),
+		findSpec(t, environmentalFeatures, "precipitation"),
+	}
+	for _, spec := range specs {
+		for _, v := range []string{"true", "false"} {
+			if got, err := spec.parse(v); err == nil {
+				t.Errorf("%s: parsing %q = %v, expected an error", spec.feature, v, got)
+			}
+		}
+		if got, err := spec.parse("1"); err != nil || got != 1 {
+			t.Errorf("%s: parsing \"1\" = %v, %v, expected 1", spec.feature, got, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package collectors
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Limits of the wind chill formula. It is only defined for temperatures at
+// or below 10 °C and wind speeds above 4.8 km/h.
+const (
+	windChillMaxTemp  = 10.0      // °C
+	windChillMinSpeed = 4.8 / 3.6 // m/s
+)
+
+// feelsLike describes the "feels like" metrics of outdoor stations
+type feelsLike struct {
+	windChill *prometheus.Desc
+	apparent  *prometheus.Desc
+	feelsLike *prometheus.Desc
+}
+
+// newFeelsLike returns the metrics derived from temperature, humidity and
+// wind speed
+func newFeelsLike(m DeviceLister) *feelsLike {
+	labels := sourceLabels(m)
+	return &feelsLike{
+		windChill: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "wind_chill_celsius"),
+			"Wind chill temperature in degrees Celsius (JAG/TI)",
+			labels, nil,
+		),
+		apparent: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "apparent_temperature_celsius"),
+			"Apparent temperature in degrees Celsius (Steadman, as used by the Australian Bureau of Meteorology)",
+			labels, nil,
+		),
+		feelsLike: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "feels_like_celsius"),
+			"Feels like temperature in degrees Celsius, the wind chill when cold, the heat index when hot and the air temperature otherwise",
+			labels, nil,
+		),
+	}
+}
+
+// describe sends the metrics descriptions into the channel
+func (c *feelsLike) describe(ch chan<- *prometheus.Desc) {
+	ch <- c.windChill
+	ch <- c.apparent
+	ch <- c.feelsLike
+}
+
+// collectWindChill sends the wind chill for a temperature and wind speed
+// into the channel, if the formula is valid for them
+func (c *feelsLike) collectWindChill(ch chan<- prometheus.Metric, labels []string, temp, windSpeed float64) {
+	if wc, ok := windChill(temp, windSpeed); ok {
+		ch <- prometheus.MustNewConstMetric(c.windChill,
+			prometheus.GaugeValue, wc, labels...)
+	}
+}
+
+// collect sends the apparent and "feels like" temperatures into the
+// channel
+func (c *feelsLike) collect(ch chan<- prometheus.Metric, labels []string, temp, relativeHumidity, windSpeed float64) {
+	ch <- prometheus.MustNewConstMetric(c.apparent,
+		prometheus.GaugeValue, apparentTemperature(temp, relativeHumidity, windSpeed), labels...)
+	ch <- prometheus.MustNewConstMetric(c.feelsLike,
+		prometheus.GaugeValue, feelsLikeTemperature(temp, relativeHumidity, windSpeed), labels...)
+}
+
+// windChill returns the wind chill temperature in degrees Celsius for a
+// wind speed in m/s, using the JAG/TI formula used in North America and by
+// SMHI. It is only defined at or below 10 °C and above 4.8 km/h, false is
+// returned outside of that range.
+// https://en.wikipedia.org/wiki/Wind_chill#North_American_and_United_Kingdom_wind_chill_index
+func windChill(temp, windSpeed float64) (float64, bool) {
+	if temp > windChillMaxTemp || windSpeed <= windChillMinSpeed {
+		return 0, false
+	}
+	v := math.Pow(windSpeed*3.6, 0.16)
+	return 13.12 + 0.6215*temp - 11.37*v + 0.3965*temp*v, true
+}
+
+// apparentTemperature returns the apparent temperature in degrees Celsius
+// for a wind speed in m/s, using the version of Steadman's formula without
+// solar radiation that the Australian Bureau of Meteorology uses.
+// http://www.bom.gov.au/info/thermal_stress/#atapproximation
+func apparentTemperature(temp, relativeHumidity, windSpeed float64) float64 {
+	e := relativeHumidity / 100 * 6.105 * math.Exp(17.27*temp/(237.7+temp))
+	return temp + 0.33*e - 0.70*windSpeed - 4.00
+}
+
+// feelsLikeTemperature returns the wind chill when it is cold and windy,
+// and otherwise the heat index, which is the air temperature unless it is
+// hot
+func feelsLikeTemperature(temp, relativeHumidity, windSpeed float64) float64 {
+	if wc, ok := windChill(temp, windSpeed); ok {
+		return wc
+	}
+	return humiture(temp, relativeHumidity)
+}
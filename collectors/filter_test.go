@@ -0,0 +1,26 @@
+package collectors
+
+import (
+	"testing"
+
+	"hemtjan.st/sensorer/collectors/collectortest"
+)
+
+func TestFilterCollector(t *testing.T) {
+	h := collectortest.New(t)
+	h.Announce("purifier/bedroom", "airPurifier", "filterChangeIndication")
+	h.Set("purifier/bedroom", "filterChangeIndication", "1")
+	h.Announce("purifier/office", "airPurifier", "filterChangeIndication")
+	h.Set("purifier/office", "filterChangeIndication", "0")
+
+	c, err := NewFilterCollector(h.Manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_filter_needs_replacement Filter needs replacement
+# TYPE sensors_filter_needs_replacement gauge
+sensors_filter_needs_replacement{source="purifier/bedroom"} 1
+sensors_filter_needs_replacement{source="purifier/office"} 0
+`)
+}
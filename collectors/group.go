@@ -0,0 +1,173 @@
+package collectors
+
+import (
+	"log"
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lib.hemtjan.st/server"
+)
+
+// groupAggregations are the aggregations exported for every group, in the
+// agg label
+var groupAggregations = []string{"min", "max", "mean", "sum"}
+
+// Group is a set of devices whose features are aggregated
+type Group struct {
+	Name string
+	// Features lists the aggregated features, all of them are aggregated
+	// when it is empty
+	Features []string
+	// Match returns true for the devices in the group
+	Match func(d server.Device) bool
+}
+
+// aggregates returns true if the group aggregates the given feature
+func (g Group) aggregates(feature string) bool {
+	if len(g.Features) == 0 {
+		return true
+	}
+	for _, f := range g.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// groupSpecs returns the specs of the features that can be aggregated. These
+// are the gauges of all collectors, except for state sets and features that
+// share their metric with another feature, like the phases of a power meter.
+func groupSpecs() []featureSpec {
+	var specs []featureSpec
+	seen := map[string]bool{}
+	for _, table := range [][]featureSpec{
+		environmentalFeatures,
+		airQualityFeatures,
+		climateFeatures,
+		powerFeatures,
+		utilityMeterFeatures,
+		batteryFeatures,
+		linkFeatures,
+		lightFeatures,
+		positionFeatures,
+		contactFeatures,
+		safetyFeatures,
+		filterFeatures,
+	} {
+		for _, s := range table {
+			if s.valueType != prometheus.GaugeValue || len(s.states) > 0 || len(s.labels) > 0 {
+				continue
+			}
+			if seen[s.feature] || seen[s.metric] {
+				continue
+			}
+			seen[s.feature] = true
+			seen[s.metric] = true
+			specs = append(specs, s)
+		}
+	}
+	return specs
+}
+
+// GroupFeatures returns the names of the features that can be aggregated
+func GroupFeatures() []string {
+	specs := groupSpecs()
+	names := make([]string, 0, len(specs))
+	for _, s := range specs {
+		names = append(names, s.feature)
+	}
+	return names
+}
+
+// GroupCollector exports aggregates of the features of groups of devices,
+// as sensors_group_<metric>{group,agg}
+type GroupCollector struct {
+	specs  []featureSpec
+	descs  []*prometheus.Desc
+	groups []Group
+	m      DeviceLister
+}
+
+// NewGroupCollector returns a collector aggregating the features of the
+// devices in groups
+func NewGroupCollector(m DeviceLister, groups []Group) (prometheus.Collector, error) {
+	specs := groupSpecs()
+	descs := make([]*prometheus.Desc, 0, len(specs))
+	for _, s := range specs {
+		descs = append(descs, prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "group", s.metric),
+			s.help+", aggregated over a group of devices",
+			[]string{"group", "agg"}, nil,
+		))
+	}
+	return &GroupCollector{
+		specs:  specs,
+		descs:  descs,
+		groups: groups,
+		m:      m,
+	}, nil
+}
+
+// Describe sends all metrics descriptions into the channel
+func (c *GroupCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+// Collect sends metric updates into the channel
+func (c *GroupCollector) Collect(ch chan<- prometheus.Metric) {
+	if len(c.groups) == 0 {
+		return
+	}
+	devices := c.m.Devices()
+	for _, g := range c.groups {
+		values := make([][]float64, len(c.specs))
+		for _, s := range devices {
+			if !g.Match(s) {
+				continue
+			}
+			for i, spec := range c.specs {
+				if !g.aggregates(spec.feature) {
+					continue
+				}
+				ft := s.Feature(spec.feature)
+				if !ft.Exists() || ft.Value() == "" {
+					continue
+				}
+				v, err := spec.parse(ft.Value())
+				if err != nil {
+					log.Printf("%s: %s: %s", s.Info().Topic, spec.feature, err.Error())
+					continue
+				}
+				if spec.scale != 0 {
+					v *= spec.scale
+				}
+				values[i] = append(values[i], v)
+			}
+		}
+		for i, vs := range values {
+			if len(vs) == 0 {
+				continue
+			}
+			for j, v := range aggregate(vs) {
+				ch <- prometheus.MustNewConstMetric(c.descs[i],
+					prometheus.GaugeValue, v, g.Name, groupAggregations[j])
+			}
+		}
+	}
+}
+
+// aggregate returns the min, max, mean and sum of vs, in the order of
+// groupAggregations
+func aggregate(vs []float64) []float64 {
+	min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+	for _, v := range vs {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+		sum += v
+	}
+	return []float64{min, max, sum / float64(len(vs)), sum}
+}
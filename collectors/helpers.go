@@ -2,11 +2,52 @@ package collectors // import "hemtjan.st/sensorer/collectors"
 
 import (
 	"strconv"
+
+	"lib.hemtjan.st/server"
 )
 
 // namespace is the Prometheus namespaces for all collectors in this package
 const namespace = "sensors"
 
+// DeviceLister lists the devices collectors export metrics for. It is
+// satisfied by *server.Manager.
+type DeviceLister interface {
+	Devices() []server.Device
+}
+
+// Labeler is implemented by a DeviceLister that attaches extra labels to
+// all metrics of its devices
+type Labeler interface {
+	// LabelNames returns the names of the extra labels
+	LabelNames() []string
+	// LabelValues returns the values of the extra labels for a device, in
+	// the same order as LabelNames
+	LabelValues(d server.Device) []string
+}
+
+// sourceLabels returns the variable labels of metrics exported for the
+// devices of m
+func sourceLabels(m DeviceLister) []string {
+	if l, ok := m.(Labeler); ok {
+		return append([]string{"source"}, l.LabelNames()...)
+	}
+	return []string{"source"}
+}
+
+// sourceValues returns the label values of a metric exported for device d
+// of m. The extra labels are left empty for metrics that don't belong to a
+// device, in which case d is nil.
+func sourceValues(m DeviceLister, d server.Device, source string) []string {
+	l, ok := m.(Labeler)
+	if !ok {
+		return []string{source}
+	}
+	if d == nil {
+		return append([]string{source}, make([]string, len(l.LabelNames()))...)
+	}
+	return append([]string{source}, l.LabelValues(d)...)
+}
+
 // toFloat takes a string and parses it into a float
 func toFloat(s string) (float64, error) {
 	f, err := strconv.ParseFloat(s, 64)
@@ -15,3 +56,20 @@ func toFloat(s string) (float64, error) {
 	}
 	return f, nil
 }
+
+// toBinary parses the value of a binary or enumerated feature. Besides
+// numbers it accepts booleans, as some devices report them, which are
+// parsed as 1 and 0.
+func toBinary(s string) (float64, error) {
+	f, err := toFloat(s)
+	if err != nil {
+		if b, berr := strconv.ParseBool(s); berr == nil {
+			if b {
+				return 1.0, nil
+			}
+			return 0.0, nil
+		}
+		return 0.0, err
+	}
+	return f, nil
+}
@@ -0,0 +1,71 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lib.hemtjan.st/server"
+)
+
+// infoLabels are the labels of the device info metric, next to source
+var infoLabels = []string{"name", "manufacturer", "model", "serial", "type"}
+
+// InfoLabels returns the names of the device info fields that can be used
+// as labels
+func InfoLabels() []string {
+	return append([]string(nil), infoLabels...)
+}
+
+// InfoLabelValue returns the value of the device info field for the given
+// label name
+func InfoLabelValue(d server.Device, label string) string {
+	info := d.Info()
+	switch label {
+	case "name":
+		return info.Name
+	case "manufacturer":
+		return info.Manufacturer
+	case "model":
+		return info.Model
+	case "serial":
+		return info.SerialNumber
+	case "type":
+		return info.Type
+	}
+	return ""
+}
+
+// DeviceInfoCollector exports the metadata devices announce
+type DeviceInfoCollector struct {
+	deviceInfo *prometheus.Desc
+	m          DeviceLister
+}
+
+// NewDeviceInfoCollector returns a collector exporting device metadata
+func NewDeviceInfoCollector(m DeviceLister) (prometheus.Collector, error) {
+	return &DeviceInfoCollector{
+		m: m,
+		deviceInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "device", "info"),
+			"Metadata of the device, always 1",
+			append([]string{"source"}, infoLabels...), nil,
+		),
+	}, nil
+}
+
+// Describe sends all metrics descriptions into the channel
+func (c *DeviceInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.deviceInfo
+}
+
+// Collect sends metric updates into the channel
+func (c *DeviceInfoCollector) Collect(ch chan<- prometheus.Metric) {
+	devices := c.m.Devices()
+	for _, s := range devices {
+		values := []string{s.Info().Topic}
+		for _, l := range infoLabels {
+			values = append(values, InfoLabelValue(s, l))
+		}
+		ch <- prometheus.MustNewConstMetric(c.deviceInfo,
+			prometheus.GaugeValue, 1, values...)
+	}
+}
@@ -0,0 +1,77 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lightFeatures are the features exported by the LightCollector
+var lightFeatures = []featureSpec{
+	{
+		feature:   "on",
+		metric:    "light_on",
+		help:      "Light or switch is on",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "brightness",
+		metric:    "light_brightness_percent",
+		help:      "Brightness in percent",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "hue",
+		metric:    "light_hue_degrees",
+		help:      "Hue in degrees",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "saturation",
+		metric:    "light_saturation_percent",
+		help:      "Saturation in percent",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "colorTemperature",
+		metric:    "light_color_temperature_mired",
+		help:      "Color temperature in mired",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "outletInUse",
+		metric:    "outlet_in_use",
+		help:      "Something is plugged into the outlet",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+}
+
+// LightCollector gets the state of lights, switches and outlets. The time
+// spent on is kept from update events, so the energy used by lights
+// without power metering can be estimated.
+type LightCollector struct {
+	*featureCollector
+	light  *stateMetrics
+	states *StateTracker
+}
+
+// NewLightCollector returns a collector fetching light and switch data
+func NewLightCollector(m DeviceLister, states *StateTracker) (prometheus.Collector, error) {
+	return &LightCollector{
+		featureCollector: newFeatureCollector(m, lightFeatures),
+		light:            newStateMetrics(m, "on", "light", "on", "off"),
+		states:           states,
+	}, nil
+}
+
+// Describe sends all metrics descriptions into the channel
+func (c *LightCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.featureCollector.Describe(ch)
+	c.light.describe(ch)
+}
+
+// Collect sends metric updates into the channel
+func (c *LightCollector) Collect(ch chan<- prometheus.Metric) {
+	c.featureCollector.Collect(ch)
+	c.light.collect(ch, c.m, c.states)
+}
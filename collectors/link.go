@@ -0,0 +1,69 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// linkFeatures are the features exported by the LinkCollector
+var linkFeatures = []featureSpec{
+	{
+		feature:   "linkQuality",
+		metric:    "link_quality",
+		help:      "Link quality indicator as reported by the radio",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "rssi",
+		metric:    "link_rssi_dbm",
+		help:      "Received signal strength in dBm",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "signalStrength",
+		metric:    "link_signal_strength",
+		help:      "Signal strength as reported by the device",
+		valueType: prometheus.GaugeValue,
+	},
+}
+
+// LinkCollector gets radio link quality data of sensors, together with the
+// bridge they are connected through
+type LinkCollector struct {
+	*featureCollector
+	bridge *prometheus.Desc
+}
+
+// NewLinkCollector returns a collector fetching radio link data of sensors
+func NewLinkCollector(m DeviceLister) (prometheus.Collector, error) {
+	return &LinkCollector{
+		featureCollector: newFeatureCollector(m, linkFeatures),
+		bridge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "link", "bridge_info"),
+			"Bridge or gateway the device is connected through, always 1",
+			append(sourceLabels(m), "bridge"), nil,
+		),
+	}, nil
+}
+
+// Describe sends all metrics descriptions into the channel
+func (c *LinkCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.featureCollector.Describe(ch)
+	ch <- c.bridge
+}
+
+// Collect sends metric updates into the channel
+func (c *LinkCollector) Collect(ch chan<- prometheus.Metric) {
+	c.featureCollector.Collect(ch)
+
+	devices := c.m.Devices()
+	for _, s := range devices {
+		// Only a bridge announced by the device is exported. The ID of
+		// the MQTT client that announced it may be anything.
+		bridge := s.Feature("bridge").Value()
+		if bridge == "" {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.bridge,
+			prometheus.GaugeValue, 1, append(sourceValues(c.m, s, s.Info().Topic), bridge)...)
+	}
+}
@@ -0,0 +1,44 @@
+package collectors
+
+import (
+	"testing"
+
+	"hemtjan.st/sensorer/collectors/collectortest"
+	"lib.hemtjan.st/device"
+)
+
+func TestLinkCollector(t *testing.T) {
+	h := collectortest.New(t)
+	h.AnnounceInfo(&device.Info{
+		Topic:      "sensor/porch",
+		Name:       "Porch",
+		Type:       "sensor",
+		LastWillID: "zigbee2mqtt",
+	}, "linkQuality", "bridge")
+	h.Set("sensor/porch", "linkQuality", "120")
+	h.Set("sensor/porch", "bridge", "coordinator-1")
+	// The client that announced the device isn't necessarily its bridge
+	h.AnnounceInfo(&device.Info{
+		Topic:      "sensor/garden",
+		Name:       "Garden",
+		Type:       "sensor",
+		LastWillID: "rtl433",
+	}, "rssi")
+	h.Set("sensor/garden", "rssi", "-87")
+
+	c, err := NewLinkCollector(h.Manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_link_bridge_info Bridge or gateway the device is connected through, always 1
+# TYPE sensors_link_bridge_info gauge
+sensors_link_bridge_info{bridge="coordinator-1",source="sensor/porch"} 1
+# HELP sensors_link_quality Link quality indicator as reported by the radio
+# TYPE sensors_link_quality gauge
+sensors_link_quality{source="sensor/porch"} 120
+# HELP sensors_link_rssi_dbm Received signal strength in dBm
+# TYPE sensors_link_rssi_dbm gauge
+sensors_link_rssi_dbm{source="sensor/garden"} -87
+`)
+}
@@ -0,0 +1,70 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// positionFeatures are the features exported by the PositionCollector
+var positionFeatures = []featureSpec{
+	{
+		feature:   "currentPosition",
+		metric:    "position_current_percent",
+		help:      "Current position in percent, 0 is closed",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "targetPosition",
+		metric:    "position_target_percent",
+		help:      "Target position in percent, 0 is closed",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "positionState",
+		metric:    "position_state",
+		help:      "Direction the position is moving in",
+		valueType: prometheus.GaugeValue,
+		states:    []string{"decreasing", "increasing", "stopped"},
+	},
+	{
+		feature:   "lockCurrentState",
+		metric:    "lock_current_state",
+		help:      "Current state of the lock",
+		valueType: prometheus.GaugeValue,
+		states:    []string{"unlocked", "locked", "jammed", "unknown"},
+	},
+	{
+		feature:   "lockTargetState",
+		metric:    "lock_target_state",
+		help:      "Target state of the lock",
+		valueType: prometheus.GaugeValue,
+		states:    []string{"unlocked", "locked"},
+	},
+	{
+		feature:   "currentDoorState",
+		metric:    "door_state",
+		help:      "Current state of the door",
+		valueType: prometheus.GaugeValue,
+		states:    []string{"open", "closed", "opening", "closing", "stopped"},
+	},
+	{
+		feature:   "obstructionDetected",
+		metric:    "obstruction_detected",
+		help:      "Obstruction detected",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+}
+
+// PositionCollector gets the state of window coverings, locks and garage
+// doors
+type PositionCollector struct {
+	*featureCollector
+}
+
+// NewPositionCollector returns a collector fetching window covering, lock
+// and door data
+func NewPositionCollector(m DeviceLister) (prometheus.Collector, error) {
+	return &PositionCollector{
+		featureCollector: newFeatureCollector(m, positionFeatures),
+	}, nil
+}
@@ -1,195 +1,172 @@
 package collectors
 
 import (
-	"fmt"
-	"log"
-	"strconv"
-
 	"github.com/prometheus/client_golang/prometheus"
 
 	"lib.hemtjan.st/feature"
-	"lib.hemtjan.st/server"
 )
 
+// powerFeatures are the features exported by the PowerCollector. The
+// features of the phases of a meter are exported as separate metrics with
+// the phase label, next to the totals of the meter.
+var powerFeatures = []featureSpec{
+	{
+		feature:   feature.CurrentPower.String(),
+		metric:    "power_current_watts",
+		help:      "Current power draw in Watts",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "currentPowerProduced",
+		metric:    "power_produced_current_watts",
+		help:      "Current power production in Watts",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   feature.EnergyUsed.String(),
+		metric:    "power_total_kwh",
+		help:      "Total power usage in kWh",
+		valueType: prometheus.CounterValue,
+	},
+	{
+		feature:   "energyProduced",
+		metric:    "power_produced_total_kwh",
+		help:      "Total power production in kWh",
+		valueType: prometheus.CounterValue,
+	},
+	{
+		feature:   feature.CurrentVoltage.String(),
+		metric:    "power_current_voltage",
+		help:      "Current voltage",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   feature.CurrentAmpere.String(),
+		metric:    "power_current_ampere",
+		help:      "Current power draw in Amperes",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "powerFactor",
+		metric:    "power_factor_ratio",
+		help:      "Power factor, the ratio of real to apparent power",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "reactivePower",
+		metric:    "power_reactive_var",
+		help:      "Current reactive power in volt-amperes reactive",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "apparentPower",
+		metric:    "power_apparent_volt_amperes",
+		help:      "Current apparent power in volt-amperes",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "frequency",
+		metric:    "power_frequency_hertz",
+		help:      "Current grid frequency in Hertz",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "phase1Voltage",
+		metric:    "power_phase_current_voltage",
+		help:      "Current voltage of a phase",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "1"},
+	},
+	{
+		feature:   "phase1Current",
+		metric:    "power_phase_current_ampere",
+		help:      "Current power draw of a phase in Amperes",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "1"},
+	},
+	{
+		feature:   "phase2Voltage",
+		metric:    "power_phase_current_voltage",
+		help:      "Current voltage of a phase",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "2"},
+	},
+	{
+		feature:   "phase2Current",
+		metric:    "power_phase_current_ampere",
+		help:      "Current power draw of a phase in Amperes",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "2"},
+	},
+	{
+		feature:   "phase3Voltage",
+		metric:    "power_phase_current_voltage",
+		help:      "Current voltage of a phase",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "3"},
+	},
+	{
+		feature:   "phase3Current",
+		metric:    "power_phase_current_ampere",
+		help:      "Current power draw of a phase in Amperes",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "3"},
+	},
+	{
+		feature:   "phase1Power",
+		metric:    "power_phase_current_watts",
+		help:      "Current power draw of a phase in Watts",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "1"},
+	},
+	{
+		feature:   "phase1PowerProduced",
+		metric:    "power_phase_produced_current_watts",
+		help:      "Current power production of a phase in Watts",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "1"},
+	},
+	{
+		feature:   "phase2Power",
+		metric:    "power_phase_current_watts",
+		help:      "Current power draw of a phase in Watts",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "2"},
+	},
+	{
+		feature:   "phase2PowerProduced",
+		metric:    "power_phase_produced_current_watts",
+		help:      "Current power production of a phase in Watts",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "2"},
+	},
+	{
+		feature:   "phase3Power",
+		metric:    "power_phase_current_watts",
+		help:      "Current power draw of a phase in Watts",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "3"},
+	},
+	{
+		feature:   "phase3PowerProduced",
+		metric:    "power_phase_produced_current_watts",
+		help:      "Current power production of a phase in Watts",
+		valueType: prometheus.GaugeValue,
+		labels:    prometheus.Labels{"phase": "3"},
+	},
+}
+
 // PowerCollector gets power data from sensors
 type PowerCollector struct {
-	powerCurrent         *prometheus.Desc
-	powerProducedCurrent *prometheus.Desc
-	powerTotal           *prometheus.Desc
-	powerProducedTotal   *prometheus.Desc
-	voltageCurrent       *prometheus.Desc
-	voltageCurrentPhase  *prometheus.Desc
-	ampereCurrent        *prometheus.Desc
-	ampereCurrentPhase   *prometheus.Desc
-	m                    *server.Manager
+	*featureCollector
 }
 
-// NewPowerCollector returns a collector fetching power sensor data
-func NewPowerCollector(m *server.Manager) (prometheus.Collector, error) {
+// NewPowerCollector returns a collector fetching power sensor data, using
+// counters to follow resets of the energy counters
+func NewPowerCollector(m DeviceLister, counters *CounterTracker) (prometheus.Collector, error) {
+	fc := newFeatureCollector(m, powerFeatures)
+	fc.counters = counters
 	return &PowerCollector{
-		m: m,
-		powerCurrent: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "power", "current_watts"),
-			"Current power draw in Watts",
-			[]string{"source"}, nil,
-		),
-		powerProducedCurrent: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "power", "produced_current_watts"),
-			"Current power production in Watts",
-			[]string{"source"}, nil,
-		),
-		powerTotal: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "power", "total_kwh"),
-			"Total power usage in kWh",
-			[]string{"source"}, nil,
-		),
-		powerProducedTotal: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "power", "produced_total_kwh"),
-			"Total power production in kWh",
-			[]string{"source"}, nil,
-		),
-		voltageCurrent: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "power", "current_voltage"),
-			"Current voltage",
-			[]string{"source"}, nil,
-		),
-		ampereCurrent: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "power", "current_ampere"),
-			"Current power draw in Amperes",
-			[]string{"source"}, nil,
-		),
-		voltageCurrentPhase: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "power", "current_voltage"),
-			"Current voltage",
-			[]string{"source", "phase"}, nil,
-		),
-		ampereCurrentPhase: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "power", "current_ampere"),
-			"Current power draw in Amperes",
-			[]string{"source", "phase"}, nil,
-		),
+		featureCollector: fc,
 	}, nil
 }
-
-// Describe sends all metrics descriptions into the channel
-func (c *PowerCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- c.powerCurrent
-	ch <- c.powerProducedCurrent
-	ch <- c.powerTotal
-	ch <- c.powerProducedTotal
-	ch <- c.voltageCurrent
-	ch <- c.ampereCurrent
-}
-
-// Collect sends metric updates into the channel
-func (c *PowerCollector) Collect(ch chan<- prometheus.Metric) {
-	devices := c.m.Devices()
-	for _, s := range devices {
-		if ft := s.Feature(feature.CurrentPower.String()); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.powerCurrent,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("currentPowerProduced"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.powerProducedCurrent,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature(feature.EnergyUsed.String()); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.powerTotal,
-				prometheus.CounterValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature("energyProduced"); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.powerProducedTotal,
-				prometheus.CounterValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature(feature.CurrentVoltage.String()); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.voltageCurrent,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		if ft := s.Feature(feature.CurrentAmpere.String()); ft.Exists() {
-			v := ft.Value()
-			if v == "" {
-				continue
-			}
-			vf, err := toFloat(v)
-			if err != nil {
-				log.Print(err.Error())
-				continue
-			}
-			ch <- prometheus.MustNewConstMetric(c.ampereCurrent,
-				prometheus.GaugeValue, vf, s.Info().Topic)
-		}
-		for _, phase := range []int{1, 2, 3} {
-			if ft := s.Feature(fmt.Sprintf("phase%dVoltage", phase)); ft.Exists() {
-				v := ft.Value()
-				if v == "" {
-					continue
-				}
-				vf, err := toFloat(v)
-				if err != nil {
-					log.Print(err.Error())
-					continue
-				}
-				ch <- prometheus.MustNewConstMetric(c.voltageCurrentPhase,
-					prometheus.GaugeValue, vf, s.Info().Topic, strconv.Itoa(phase))
-			}
-			if ft := s.Feature(fmt.Sprintf("phase%dCurrent", phase)); ft.Exists() {
-				v := ft.Value()
-				if v == "" {
-					continue
-				}
-				vf, err := toFloat(v)
-				if err != nil {
-					log.Print(err.Error())
-					continue
-				}
-				ch <- prometheus.MustNewConstMetric(c.ampereCurrentPhase,
-					prometheus.GaugeValue, vf, s.Info().Topic, strconv.Itoa(phase))
-			}
-		}
-	}
-}
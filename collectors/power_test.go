@@ -0,0 +1,65 @@
+package collectors
+
+import (
+	"testing"
+
+	"hemtjan.st/sensorer/collectors/collectortest"
+)
+
+func TestPowerCollector(t *testing.T) {
+	h := collectortest.New(t)
+	h.Announce("power/meter", "outlet",
+		"currentPower", "energyUsed", "currentVoltage", "currentAmpere", "phase1Voltage")
+	h.Set("power/meter", "currentPower", "1250.5")
+	h.Set("power/meter", "energyUsed", "4711")
+	h.Set("power/meter", "currentVoltage", "231")
+	h.Set("power/meter", "currentAmpere", "5.4")
+	h.Set("power/meter", "phase1Voltage", "229")
+
+	c, err := NewPowerCollector(h.Manager, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_power_current_ampere Current power draw in Amperes
+# TYPE sensors_power_current_ampere gauge
+sensors_power_current_ampere{source="power/meter"} 5.4
+# HELP sensors_power_current_voltage Current voltage
+# TYPE sensors_power_current_voltage gauge
+sensors_power_current_voltage{source="power/meter"} 231
+# HELP sensors_power_current_watts Current power draw in Watts
+# TYPE sensors_power_current_watts gauge
+sensors_power_current_watts{source="power/meter"} 1250.5
+# HELP sensors_power_phase_current_voltage Current voltage of a phase
+# TYPE sensors_power_phase_current_voltage gauge
+sensors_power_phase_current_voltage{phase="1",source="power/meter"} 229
+# HELP sensors_power_total_kwh Total power usage in kWh
+# TYPE sensors_power_total_kwh counter
+sensors_power_total_kwh{source="power/meter"} 4711
+`)
+}
+
+func TestPowerCollectorInvalidValue(t *testing.T) {
+	h := collectortest.New(t)
+	h.Announce("power/meter", "outlet",
+		"currentPower", "energyUsed", "currentVoltage", "currentAmpere")
+	h.Set("power/meter", "currentPower", "unavailable")
+	h.Set("power/meter", "energyUsed", "4711")
+	h.Set("power/meter", "currentVoltage", "231")
+	h.Set("power/meter", "currentAmpere", "")
+
+	c, err := NewPowerCollector(h.Manager, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The current power and ampere can't be parsed, the other features of
+	// the device are still exported
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_power_current_voltage Current voltage
+# TYPE sensors_power_current_voltage gauge
+sensors_power_current_voltage{source="power/meter"} 231
+# HELP sensors_power_total_kwh Total power usage in kWh
+# TYPE sensors_power_total_kwh counter
+sensors_power_total_kwh{source="power/meter"} 4711
+`)
+}
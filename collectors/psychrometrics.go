@@ -0,0 +1,125 @@
+package collectors
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Magnus coefficients over water (Sonntag 1990), valid from -45 to 60 °C
+const (
+	magnusA  = 17.62
+	magnusB  = 243.12 // °C
+	magnusE0 = 611.2  // Pa
+)
+
+// waterVapourGasConstant is the specific gas constant of water vapour in
+// J/(kg·K)
+const waterVapourGasConstant = 461.5
+
+// psychrometrics describes the metrics derived from the temperature and
+// relative humidity of a device
+type psychrometrics struct {
+	dewPoint         *prometheus.Desc
+	absoluteHumidity *prometheus.Desc
+	wetBulb          *prometheus.Desc
+	vpd              *prometheus.Desc
+}
+
+// newPsychrometrics returns the metrics derived from temperature and
+// humidity
+func newPsychrometrics(m DeviceLister) *psychrometrics {
+	labels := sourceLabels(m)
+	return &psychrometrics{
+		dewPoint: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "dew_point_celsius"),
+			"Dew point in degrees Celsius",
+			labels, nil,
+		),
+		absoluteHumidity: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "humidity_absolute_grams_per_cubic_meter"),
+			"Absolute humidity in g/m³",
+			labels, nil,
+		),
+		wetBulb: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "wet_bulb_temperature_celsius"),
+			"Wet-bulb temperature in degrees Celsius",
+			labels, nil,
+		),
+		vpd: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "vapour_pressure_deficit_pascals"),
+			"Vapour pressure deficit in Pascals",
+			labels, nil,
+		),
+	}
+}
+
+// describe sends the metrics descriptions into the channel
+func (c *psychrometrics) describe(ch chan<- *prometheus.Desc) {
+	ch <- c.dewPoint
+	ch <- c.absoluteHumidity
+	ch <- c.wetBulb
+	ch <- c.vpd
+}
+
+// collect sends the metrics derived from a temperature and relative
+// humidity into the channel. Values the formulas aren't valid for are
+// skipped.
+func (c *psychrometrics) collect(ch chan<- prometheus.Metric, labels []string, temp, relativeHumidity float64) {
+	if relativeHumidity <= 0 || relativeHumidity > 100 || temp <= -magnusB {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.dewPoint,
+		prometheus.GaugeValue, dewPoint(temp, relativeHumidity), labels...)
+	ch <- prometheus.MustNewConstMetric(c.absoluteHumidity,
+		prometheus.GaugeValue, absoluteHumidity(temp, relativeHumidity), labels...)
+	ch <- prometheus.MustNewConstMetric(c.vpd,
+		prometheus.GaugeValue, vapourPressureDeficit(temp, relativeHumidity), labels...)
+	if wb, ok := wetBulb(temp, relativeHumidity); ok {
+		ch <- prometheus.MustNewConstMetric(c.wetBulb,
+			prometheus.GaugeValue, wb, labels...)
+	}
+}
+
+// saturationVapourPressure returns the saturation vapour pressure over
+// water in Pascals, using the Magnus formula
+func saturationVapourPressure(temp float64) float64 {
+	return magnusE0 * math.Exp(magnusA*temp/(magnusB+temp))
+}
+
+// dewPoint returns the dew point in degrees Celsius, using the Magnus
+// formula
+// https://en.wikipedia.org/wiki/Dew_point#Calculating_the_dew_point
+func dewPoint(temp, relativeHumidity float64) float64 {
+	gamma := math.Log(relativeHumidity/100) + magnusA*temp/(magnusB+temp)
+	return magnusB * gamma / (magnusA - gamma)
+}
+
+// absoluteHumidity returns the mass of water vapour in g/m³, using the
+// ideal gas law
+func absoluteHumidity(temp, relativeHumidity float64) float64 {
+	e := relativeHumidity / 100 * saturationVapourPressure(temp)
+	return e / (waterVapourGasConstant * (temp + 273.15)) * 1000
+}
+
+// vapourPressureDeficit returns the difference between the saturation
+// vapour pressure and the actual vapour pressure in Pascals
+func vapourPressureDeficit(temp, relativeHumidity float64) float64 {
+	return (1 - relativeHumidity/100) * saturationVapourPressure(temp)
+}
+
+// wetBulb returns the wet-bulb temperature in degrees Celsius at standard
+// sea level pressure, using the empirical formula by Stull (2011). It is
+// only valid from -20 to 50 °C and 5 to 99 % relative humidity, false is
+// returned outside of that range.
+// https://doi.org/10.1175/JAMC-D-11-0143.1
+func wetBulb(temp, relativeHumidity float64) (float64, bool) {
+	if temp < -20 || temp > 50 || relativeHumidity < 5 || relativeHumidity > 99 {
+		return 0, false
+	}
+	rh := relativeHumidity
+	return temp*math.Atan(0.151977*math.Sqrt(rh+8.313659)) +
+		math.Atan(temp+rh) - math.Atan(rh-1.676331) +
+		0.00391838*math.Pow(rh, 1.5)*math.Atan(0.023101*rh) -
+		4.686035, true
+}
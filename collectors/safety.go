@@ -0,0 +1,106 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// safetyFeatures are the features exported by the SafetyCollector
+var safetyFeatures = []featureSpec{
+	{
+		feature:   "smokeDetected",
+		metric:    "smoke_detected",
+		help:      "Smoke detected",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "leakDetected",
+		metric:    "leak_detected",
+		help:      "Leak detected",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "motionDetected",
+		metric:    "motion_detected",
+		help:      "Motion detected",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "occupancyDetected",
+		metric:    "occupancy_detected",
+		help:      "Occupancy detected",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "statusTampered",
+		metric:    "status_tampered",
+		help:      "Device has been tampered with",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "statusFault",
+		metric:    "status_fault",
+		help:      "Device reports a fault",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "statusActive",
+		metric:    "status_active",
+		help:      "Device is active",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+	{
+		feature:   "statusLowBattery",
+		metric:    "status_low_battery",
+		help:      "Device reports a low battery",
+		valueType: prometheus.GaugeValue,
+		binary:    true,
+	},
+}
+
+// SafetyCollector gets the state of security and safety sensors. Like for
+// contacts, the transitions of detection features are exported so that
+// brief pulses are not lost between two scrapes.
+type SafetyCollector struct {
+	*featureCollector
+	detections []*stateMetrics
+	states     *StateTracker
+}
+
+// NewSafetyCollector returns a collector fetching security and safety
+// sensor data
+func NewSafetyCollector(m DeviceLister, states *StateTracker) (prometheus.Collector, error) {
+	return &SafetyCollector{
+		featureCollector: newFeatureCollector(m, safetyFeatures),
+		detections: []*stateMetrics{
+			newStateMetrics(m, "smokeDetected", "smoke", "detected", "clear"),
+			newStateMetrics(m, "leakDetected", "leak", "detected", "clear"),
+			newStateMetrics(m, "motionDetected", "motion", "detected", "clear"),
+			newStateMetrics(m, "occupancyDetected", "occupancy", "detected", "clear"),
+			newStateMetrics(m, "statusTampered", "tamper", "tampered", "clear"),
+		},
+		states: states,
+	}, nil
+}
+
+// Describe sends all metrics descriptions into the channel
+func (c *SafetyCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.featureCollector.Describe(ch)
+	for _, d := range c.detections {
+		d.describe(ch)
+	}
+}
+
+// Collect sends metric updates into the channel
+func (c *SafetyCollector) Collect(ch chan<- prometheus.Metric) {
+	c.featureCollector.Collect(ch)
+	for _, d := range c.detections {
+		d.collect(ch, c.m, c.states)
+	}
+}
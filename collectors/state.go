@@ -0,0 +1,310 @@
+package collectors
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lib.hemtjan.st/feature"
+	"lib.hemtjan.st/server"
+)
+
+// stateFeatures are the binary features whose transitions the StateTracker
+// follows
+var stateFeatures = []string{
+	feature.ContactSensorState.String(),
+	"smokeDetected",
+	"leakDetected",
+	"motionDetected",
+	"occupancyDetected",
+	"statusTampered",
+	"on",
+}
+
+// stateKey identifies a feature of a device
+type stateKey struct {
+	topic   string
+	feature string
+}
+
+// featureState is the state of a binary feature
+type featureState struct {
+	active bool
+	// since is the start of the current state, changed is the time of the
+	// last transition and zero if none has been seen
+	since   time.Time
+	changed time.Time
+	// toActive and toInactive count the transitions
+	toActive   float64
+	toInactive float64
+	// activeSeconds is the time spent in the active state, not counting
+	// the current state
+	activeSeconds float64
+}
+
+// activeSecondsAt returns the total time spent in the active state at t
+func (s featureState) activeSecondsAt(t time.Time) float64 {
+	if s.active && t.After(s.since) {
+		return s.activeSeconds + t.Sub(s.since).Seconds()
+	}
+	return s.activeSeconds
+}
+
+// StateTracker follows binary features, like contacts, and counts their
+// transitions as well as the time spent in the active state. It gets every
+// update from a Tracker, so no transition is lost between scrapes.
+type StateTracker struct {
+	mu       sync.Mutex
+	features map[string]bool
+	states   map[stateKey]*featureState
+}
+
+// NewStateTracker returns a StateTracker following the updates of t
+func NewStateTracker(t *Tracker) *StateTracker {
+	s := &StateTracker{
+		features: map[string]bool{},
+		states:   map[stateKey]*featureState{},
+	}
+	for _, f := range stateFeatures {
+		s.features[f] = true
+	}
+	t.OnSubscribe(func(d server.Device, feature, value string, t time.Time) {
+		if s.features[feature] {
+			s.seed(d.Info().Topic, feature, value, t)
+		}
+	})
+	t.OnUpdate(func(d server.Device, feature, value string, t time.Time) {
+		if s.features[feature] {
+			s.update(d.Info().Topic, feature, value, t)
+		}
+	})
+	return s
+}
+
+// update records a new value of a feature
+func (s *StateTracker) update(topic, feature, value string, t time.Time) {
+	active, ok := isActive(value)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := stateKey{topic: topic, feature: feature}
+	st, ok := s.states[key]
+	if !ok {
+		s.states[key] = &featureState{active: active, since: t}
+		return
+	}
+	if st.active == active {
+		return
+	}
+	if st.active {
+		st.activeSeconds = st.activeSecondsAt(t)
+		st.toInactive++
+	} else {
+		st.toActive++
+	}
+	st.active = active
+	st.since = t
+	st.changed = t
+}
+
+// seed reconciles the state of a feature with its value when the Tracker
+// subscribes to it. A restored state that doesn't match the value changed
+// while the exporter wasn't running, which is counted as a transition at t.
+// The time spent in the active state until then is unknown and not counted.
+func (s *StateTracker) seed(topic, feature, value string, t time.Time) {
+	active, ok := isActive(value)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := stateKey{topic: topic, feature: feature}
+	st, ok := s.states[key]
+	if !ok {
+		s.states[key] = &featureState{active: active, since: t}
+		return
+	}
+	if st.active == active {
+		return
+	}
+	if st.active {
+		st.toInactive++
+	} else {
+		st.toActive++
+	}
+	st.active = active
+	st.since = t
+	st.changed = t
+}
+
+// state returns the state of a feature. A feature the tracker hasn't seen
+// an update for yet starts out with value.
+func (s *StateTracker) state(topic, feature, value string) (featureState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := stateKey{topic: topic, feature: feature}
+	if st, ok := s.states[key]; ok {
+		return *st, true
+	}
+	active, ok := isActive(value)
+	if !ok {
+		return featureState{}, false
+	}
+	st := &featureState{active: active, since: time.Now()}
+	s.states[key] = st
+	return *st, true
+}
+
+// savedState is the state of a binary feature as it is saved by the
+// StateTracker
+type savedState struct {
+	Topic         string    `json:"topic"`
+	Feature       string    `json:"feature"`
+	Active        bool      `json:"active"`
+	Changed       time.Time `json:"changed"`
+	ToActive      float64   `json:"to_active"`
+	ToInactive    float64   `json:"to_inactive"`
+	ActiveSeconds float64   `json:"active_seconds"`
+}
+
+// MarshalJSON returns the state of all features, so that it can be saved
+// across restarts
+func (s *StateTracker) MarshalJSON() ([]byte, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := make([]savedState, 0, len(s.states))
+	for k, st := range s.states {
+		saved = append(saved, savedState{
+			Topic:         k.topic,
+			Feature:       k.feature,
+			Active:        st.active,
+			Changed:       st.changed,
+			ToActive:      st.toActive,
+			ToInactive:    st.toInactive,
+			ActiveSeconds: st.activeSecondsAt(now),
+		})
+	}
+	sort.Slice(saved, func(i, j int) bool {
+		if saved[i].Topic != saved[j].Topic {
+			return saved[i].Topic < saved[j].Topic
+		}
+		return saved[i].Feature < saved[j].Feature
+	})
+	return json.Marshal(saved)
+}
+
+// UnmarshalJSON restores the state of features saved by MarshalJSON.
+// Features the tracker already follows are replaced. The time between
+// saving and restoring isn't counted as time spent in the active state.
+func (s *StateTracker) UnmarshalJSON(b []byte) error {
+	var saved []savedState
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, st := range saved {
+		s.states[stateKey{topic: st.Topic, feature: st.Feature}] = &featureState{
+			active:        st.Active,
+			since:         now,
+			changed:       st.Changed,
+			toActive:      st.ToActive,
+			toInactive:    st.ToInactive,
+			activeSeconds: st.ActiveSeconds,
+		}
+	}
+	return nil
+}
+
+// isActive parses the value of a binary feature
+func isActive(v string) (bool, bool) {
+	f, err := toBinary(v)
+	if err != nil {
+		return false, false
+	}
+	return f != 0, true
+}
+
+// stateMetrics describes the metrics derived from a binary feature
+type stateMetrics struct {
+	feature     string
+	transitions *prometheus.Desc
+	lastChange  *prometheus.Desc
+	active      *prometheus.Desc
+	// activeName and inactiveName are the values of the "to" label
+	activeName   string
+	inactiveName string
+}
+
+// newStateMetrics returns the metrics for a binary feature. The metrics are
+// named <name>_transitions_total, <name>_last_change_timestamp_seconds and
+// <name>_<activeName>_seconds_total.
+func newStateMetrics(m DeviceLister, feature, name, activeName, inactiveName string) *stateMetrics {
+	labels := sourceLabels(m)
+	return &stateMetrics{
+		feature: feature,
+		transitions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, name, "transitions_total"),
+			"Number of state changes, by the new state",
+			append(labels, "to"), nil,
+		),
+		lastChange: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, name, "last_change_timestamp_seconds"),
+			"Time of the last state change",
+			labels, nil,
+		),
+		active: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, name, activeName+"_seconds_total"),
+			"Total time spent in the "+activeName+" state",
+			labels, nil,
+		),
+		activeName:   activeName,
+		inactiveName: inactiveName,
+	}
+}
+
+// describe sends the metrics descriptions into the channel
+func (c *stateMetrics) describe(ch chan<- *prometheus.Desc) {
+	ch <- c.transitions
+	ch <- c.lastChange
+	ch <- c.active
+}
+
+// collect sends the metrics of all devices with the feature into the
+// channel
+func (c *stateMetrics) collect(ch chan<- prometheus.Metric, m DeviceLister, states *StateTracker) {
+	now := time.Now()
+	devices := m.Devices()
+	for _, s := range devices {
+		ft := s.Feature(c.feature)
+		if !ft.Exists() {
+			continue
+		}
+		topic := s.Info().Topic
+		st, ok := states.state(topic, c.feature, ft.Value())
+		if !ok {
+			continue
+		}
+		labels := sourceValues(m, s, topic)
+		ch <- prometheus.MustNewConstMetric(c.transitions,
+			prometheus.CounterValue, st.toActive, append(labels, c.activeName)...)
+		ch <- prometheus.MustNewConstMetric(c.transitions,
+			prometheus.CounterValue, st.toInactive, append(labels, c.inactiveName)...)
+		if !st.changed.IsZero() {
+			ch <- prometheus.MustNewConstMetric(c.lastChange,
+				prometheus.GaugeValue, float64(st.changed.UnixNano())/1e9, labels...)
+		}
+		ch <- prometheus.MustNewConstMetric(c.active,
+			prometheus.CounterValue, st.activeSecondsAt(now), labels...)
+	}
+}
@@ -0,0 +1,64 @@
+package collectors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStateTrackerSeedRestored(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	s := NewStateTracker(NewTracker(nil))
+	s.seed("sensor/door", "contactSensorState", "0", start)
+	// The door is open when the exporter stops
+	s.update("sensor/door", "contactSensorState", "1", start.Add(time.Minute))
+	b, err := s.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		value      string
+		active     bool
+		toActive   float64
+		toInactive float64
+	}{
+		{"unchanged", "1", true, 1, 0},
+		{"closed while stopped", "0", false, 1, 1},
+		{"invalid", "unknown", true, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := NewStateTracker(NewTracker(nil))
+			if err := restored.UnmarshalJSON(b); err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			restored.seed("sensor/door", "contactSensorState", tt.value, now)
+
+			st, ok := restored.state("sensor/door", "contactSensorState", "")
+			if !ok {
+				t.Fatal("state not restored")
+			}
+			if st.active != tt.active {
+				t.Errorf("active is %v, expected %v", st.active, tt.active)
+			}
+			if st.toActive != tt.toActive || st.toInactive != tt.toInactive {
+				t.Errorf("%v transitions to active and %v to inactive, expected %v and %v",
+					st.toActive, st.toInactive, tt.toActive, tt.toInactive)
+			}
+			if !tt.active {
+				if !st.changed.Equal(now) {
+					t.Errorf("changed at %v, expected %v", st.changed, now)
+				}
+				// The open time stops growing once the door is known to
+				// be closed
+				later := now.Add(time.Hour)
+				if st.activeSecondsAt(later) != st.activeSecondsAt(now) {
+					t.Errorf("active seconds grew from %v to %v while inactive",
+						st.activeSecondsAt(now), st.activeSecondsAt(later))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package collectors
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"lib.hemtjan.st/server"
+)
+
+// UpdateHandler is called by the Tracker for every feature update
+type UpdateHandler func(d server.Device, feature, value string, t time.Time)
+
+// Tracker subscribes to the feature updates of all devices, so that the
+// time of the last update is known and changes happening between two
+// scrapes are not lost
+type Tracker struct {
+	mu sync.RWMutex
+	// updated holds the time of the last update by topic and feature. It
+	// is zero for features without a value yet.
+	updated  map[string]map[string]time.Time
+	handlers []UpdateHandler
+	// subscribers are called with the current value of a feature before
+	// the tracker subscribes to it
+	subscribers []UpdateHandler
+	m           DeviceLister
+}
+
+// NewTracker returns a tracker for the devices of m
+func NewTracker(m DeviceLister) *Tracker {
+	return &Tracker{
+		updated: map[string]map[string]time.Time{},
+		m:       m,
+	}
+}
+
+// OnUpdate registers a handler that is called for every feature update
+func (t *Tracker) OnUpdate(h UpdateHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers = append(t.handlers, h)
+}
+
+// OnSubscribe registers a handler that is called with the current value of
+// a feature right before the tracker subscribes to it, so that the first
+// update can be compared with it
+func (t *Tracker) OnSubscribe(h UpdateHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.subscribers = append(t.subscribers, h)
+}
+
+// Start subscribes to the features of new devices every interval until the
+// context is cancelled
+func (t *Tracker) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		t.Sync()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync subscribes to the features of devices that appeared since the
+// last call, and retries the subscriptions that failed
+func (t *Tracker) Sync() {
+	now := time.Now()
+	for _, d := range t.m.Devices() {
+		topic := d.Info().Topic
+		for name := range d.Info().Features {
+			ft := d.Feature(name)
+			if !ft.Exists() {
+				continue
+			}
+
+			t.mu.Lock()
+			updated, ok := t.updated[topic]
+			if !ok {
+				updated = map[string]time.Time{}
+				t.updated[topic] = updated
+			}
+			_, subscribed := updated[name]
+			subscribers := t.subscribers
+			t.mu.Unlock()
+			if subscribed {
+				continue
+			}
+
+			if v := ft.Value(); v != "" {
+				for _, h := range subscribers {
+					h(d, name, v, now)
+				}
+			}
+			d, name := d, name
+			err := ft.OnUpdateFunc(func(v string) {
+				t.update(d, name, v)
+			})
+			if err != nil {
+				// The feature isn't recorded, so the next Sync tries again
+				log.Printf("%s: %s: %s", topic, name, err.Error())
+				continue
+			}
+
+			t.mu.Lock()
+			if _, ok := updated[name]; !ok {
+				updated[name] = time.Time{}
+				if ft.Value() != "" {
+					// The value was received before we subscribed, the
+					// best we know is that it's current now
+					updated[name] = now
+				}
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// Update records an update of a feature the tracker doesn't subscribe to
+// itself, like a feature of a virtual device, and passes it on to the
+// handlers
+func (t *Tracker) Update(d server.Device, feature, value string) {
+	t.mu.Lock()
+	if _, ok := t.updated[d.Info().Topic]; !ok {
+		t.updated[d.Info().Topic] = map[string]time.Time{}
+	}
+	t.mu.Unlock()
+	t.update(d, feature, value)
+}
+
+// update records a feature update and passes it on to the handlers
+func (t *Tracker) update(d server.Device, feature, value string) {
+	now := time.Now()
+	t.mu.Lock()
+	if updated, ok := t.updated[d.Info().Topic]; ok {
+		updated[feature] = now
+	}
+	handlers := t.handlers
+	t.mu.Unlock()
+
+	for _, h := range handlers {
+		h(d, feature, value, now)
+	}
+}
+
+// LastUpdate returns the time a feature of the device with the given topic
+// was last updated
+func (t *Tracker) LastUpdate(topic, feature string) (time.Time, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	updated := t.updated[topic][feature]
+	return updated, !updated.IsZero()
+}
@@ -0,0 +1,48 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UpdateCollector exports when the features of devices were last updated
+type UpdateCollector struct {
+	lastUpdate *prometheus.Desc
+	m          DeviceLister
+	t          *Tracker
+}
+
+// NewUpdateCollector returns a collector exporting the time of the last
+// update of every feature known to the tracker
+func NewUpdateCollector(m DeviceLister, t *Tracker) (prometheus.Collector, error) {
+	return &UpdateCollector{
+		m: m,
+		t: t,
+		lastUpdate: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "last_update_timestamp_seconds"),
+			"Time the feature was last updated by the device",
+			append(sourceLabels(m), "feature"), nil,
+		),
+	}, nil
+}
+
+// Describe sends all metrics descriptions into the channel
+func (c *UpdateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lastUpdate
+}
+
+// Collect sends metric updates into the channel
+func (c *UpdateCollector) Collect(ch chan<- prometheus.Metric) {
+	devices := c.m.Devices()
+	for _, s := range devices {
+		topic := s.Info().Topic
+		for name := range s.Info().Features {
+			t, ok := c.t.LastUpdate(topic, name)
+			if !ok {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.lastUpdate,
+				prometheus.GaugeValue, float64(t.UnixNano())/1e9,
+				append(sourceValues(c.m, s, topic), name)...)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// liter converts litres to m³
+const liter = 1e-3
+
+// utilityMeterFeatures are the features exported by the
+// UtilityMeterCollector
+var utilityMeterFeatures = []featureSpec{
+	{
+		feature:   "waterUsed",
+		metric:    "water_used_cubic_meters_total",
+		help:      "Total water usage in m³",
+		valueType: prometheus.CounterValue,
+	},
+	{
+		// Meters reporting in litres are exported in m³ as well
+		feature:   "waterUsedLiters",
+		metric:    "water_used_cubic_meters_total",
+		help:      "Total water usage in m³",
+		valueType: prometheus.CounterValue,
+		scale:     liter,
+	},
+	{
+		feature:   "waterFlow",
+		metric:    "water_flow_liters_per_minute",
+		help:      "Current water flow in litres per minute",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "gasUsed",
+		metric:    "gas_used_cubic_meters_total",
+		help:      "Total gas usage in m³",
+		valueType: prometheus.CounterValue,
+	},
+	{
+		feature:   "gasFlow",
+		metric:    "gas_flow_cubic_meters_per_hour",
+		help:      "Current gas flow in m³ per hour",
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		feature:   "heatEnergyUsed",
+		metric:    "heat_energy_used_kwh_total",
+		help:      "Total district heating energy usage in kWh",
+		valueType: prometheus.CounterValue,
+	},
+	{
+		feature:   "heatPower",
+		metric:    "heat_power_watts",
+		help:      "Current district heating power in Watts",
+		valueType: prometheus.GaugeValue,
+	},
+}
+
+// UtilityMeterCollector gets water, gas and district heating meter
+// readings from sensors
+type UtilityMeterCollector struct {
+	*featureCollector
+}
+
+// NewUtilityMeterCollector returns a collector fetching utility meter data
+// of sensors, using counters to follow meter resets
+func NewUtilityMeterCollector(m DeviceLister, counters *CounterTracker) (prometheus.Collector, error) {
+	fc := newFeatureCollector(m, utilityMeterFeatures)
+	fc.counters = counters
+	return &UtilityMeterCollector{
+		featureCollector: fc,
+	}, nil
+}
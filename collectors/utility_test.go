@@ -0,0 +1,36 @@
+package collectors
+
+import (
+	"testing"
+
+	"hemtjan.st/sensorer/collectors/collectortest"
+)
+
+func TestUtilityMeterCollector(t *testing.T) {
+	h := collectortest.New(t)
+	h.Announce("meter/water", "meter", "waterUsed", "waterFlow")
+	h.Set("meter/water", "waterUsed", "123.456")
+	h.Set("meter/water", "waterFlow", "6.5")
+	h.Announce("meter/garden", "meter", "waterUsedLiters")
+	h.Set("meter/garden", "waterUsedLiters", "4250")
+	h.Announce("meter/gas", "meter", "gasUsed")
+	h.Set("meter/gas", "gasUsed", "812.3")
+
+	c, err := NewUtilityMeterCollector(h.Manager, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both water meters are exported in m³
+	collectortest.CollectAndCompare(t, c, `
+# HELP sensors_gas_used_cubic_meters_total Total gas usage in m³
+# TYPE sensors_gas_used_cubic_meters_total counter
+sensors_gas_used_cubic_meters_total{source="meter/gas"} 812.3
+# HELP sensors_water_flow_liters_per_minute Current water flow in litres per minute
+# TYPE sensors_water_flow_liters_per_minute gauge
+sensors_water_flow_liters_per_minute{source="meter/water"} 6.5
+# HELP sensors_water_used_cubic_meters_total Total water usage in m³
+# TYPE sensors_water_used_cubic_meters_total counter
+sensors_water_used_cubic_meters_total{source="meter/garden"} 4.25
+sensors_water_used_cubic_meters_total{source="meter/water"} 123.456
+`)
+}
@@ -0,0 +1,487 @@
+package sensorer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"hemtjan.st/sensorer/collectors"
+)
+
+// labelNameRE matches valid Prometheus label names
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels are set by the collectors themselves and can't be set
+// through the configuration
+var reservedLabels = map[string]bool{
+	"source":  true,
+	"phase":   true,
+	"feature": true,
+	"to":      true,
+	"state":   true,
+	"bridge":  true,
+}
+
+// Config holds the configuration of the exporter
+type Config struct {
+	// ListenAddress is the address:port the exporter will listen on
+	ListenAddress string `yaml:"listen_address"`
+	// Location is used to compute sunrise and sunset
+	Location Location `yaml:"location"`
+	// Collectors lists the enabled collectors. All collectors are
+	// enabled when it is empty.
+	Collectors []string `yaml:"collectors"`
+	// Devices holds overrides for individual devices, keyed by topic
+	Devices map[string]DeviceConfig `yaml:"devices"`
+	// Labels are rules attaching extra labels to the metrics of all
+	// devices whose topic matches
+	Labels []LabelRule `yaml:"labels"`
+	// InfoLabels lists device info fields, like name, that are copied
+	// onto every metric of the device
+	InfoLabels []string `yaml:"info_labels"`
+	// Staleness configures when values are considered too old to export
+	Staleness Staleness `yaml:"staleness"`
+	// Counters configures how cumulative features, like energy meter
+	// readings, are exported
+	Counters Counters `yaml:"counters"`
+	// StateFile is where the state of the exporter, like counter offsets
+	// and state transitions, is kept across restarts. It is lost on
+	// restart when StateFile is empty.
+	StateFile string `yaml:"state_file"`
+	// Virtual are devices made up of features of other devices. They are
+	// exported like any other device, under their own topic.
+	Virtual []VirtualDevice `yaml:"virtual"`
+	// Groups are sets of devices whose features are aggregated
+	Groups []Group `yaml:"groups"`
+	// StateFlushInterval is how often the state is saved, next to when
+	// the exporter stops. 0 only saves it when the exporter stops.
+	StateFlushInterval time.Duration `yaml:"state_flush_interval"`
+
+	// sources holds the virtual features by the topic of the device they
+	// are taken from
+	sources map[string][]virtualSource
+}
+
+// Group is a set of devices whose features are aggregated. A device is in
+// the group when it matches all of Topic, Type and Labels that are set.
+type Group struct {
+	Name string `yaml:"name"`
+	// Topic is a glob pattern, as understood by path.Match
+	Topic string `yaml:"topic"`
+	// Type is the device type
+	Type string `yaml:"type"`
+	// Labels are matched against the labels the configuration attaches to
+	// the device, including info_labels
+	Labels map[string]string `yaml:"labels"`
+	// Features lists the aggregated features, all of them are aggregated
+	// when it is empty
+	Features []string `yaml:"features"`
+}
+
+// VirtualDevice is a device made up of features of other devices
+type VirtualDevice struct {
+	Topic string `yaml:"topic"`
+	Name  string `yaml:"name"`
+	Type  string `yaml:"type"`
+	// Features maps the name of every feature of the device to where it
+	// is taken from
+	Features map[string]VirtualFeature `yaml:"features"`
+}
+
+// VirtualFeature is where a feature of a virtual device is taken from
+type VirtualFeature struct {
+	Topic string `yaml:"topic"`
+	// Feature defaults to the name of the virtual feature
+	Feature string `yaml:"feature"`
+}
+
+// feature returns the name of the source feature of the virtual feature
+// with the given name
+func (f VirtualFeature) feature(name string) string {
+	if f.Feature == "" {
+		return name
+	}
+	return f.Feature
+}
+
+// virtualSource is a feature of a virtual device
+type virtualSource struct {
+	device  *VirtualDevice
+	feature string
+}
+
+// virtualFeatures returns the virtual features taken from the given
+// feature of the device with the given topic
+func (c *Config) virtualFeatures(topic, feature string) []virtualSource {
+	var res []virtualSource
+	for _, v := range c.sources[topic] {
+		if v.device.Features[v.feature].feature(v.feature) == feature {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// Counters configures how cumulative features are exported. The policy is
+// one of passthrough, monotonic or ignore-decrease and defaults to
+// monotonic.
+type Counters struct {
+	Policy collectors.CounterPolicy `yaml:"policy"`
+	// Features overrides Policy by feature name
+	Features map[string]collectors.CounterPolicy `yaml:"features"`
+}
+
+// policy returns the policy of the given feature
+func (c Counters) policy(feature string) collectors.CounterPolicy {
+	if p, ok := c.Features[feature]; ok {
+		return p
+	}
+	if c.Policy == "" {
+		return collectors.CounterMonotonic
+	}
+	return c.Policy
+}
+
+// Staleness configures the maximum age of feature values. Values that were
+// not updated within the maximum age are no longer exported. A maximum age
+// of 0 disables the expiry.
+type Staleness struct {
+	MaxAge time.Duration `yaml:"max_age"`
+	// Features overrides MaxAge by feature name
+	Features map[string]time.Duration `yaml:"features"`
+}
+
+// maxAge returns the maximum age of values of the given feature
+func (s Staleness) maxAge(feature string) time.Duration {
+	if d, ok := s.Features[feature]; ok {
+		return d
+	}
+	return s.MaxAge
+}
+
+// enabled returns true if any value can expire
+func (s Staleness) enabled() bool {
+	if s.MaxAge > 0 {
+		return true
+	}
+	for _, d := range s.Features {
+		if d > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Location is a position on earth
+type Location struct {
+	Latitude  float64 `yaml:"lat"`
+	Longitude float64 `yaml:"long"`
+}
+
+// DeviceConfig overrides how a single device is exported
+type DeviceConfig struct {
+	// Ignore hides all metrics of the device
+	Ignore bool `yaml:"ignore"`
+	// Labels are attached to all metrics of the device and take
+	// precedence over labels set by label rules
+	Labels map[string]string `yaml:"labels"`
+}
+
+// LabelRule attaches labels to the metrics of devices with a matching
+// topic. Either Topic or Regex must be set.
+type LabelRule struct {
+	// Topic is a glob pattern, as understood by path.Match
+	Topic string `yaml:"topic"`
+	// Regex is a regular expression matched against the whole topic. Label
+	// values can refer to its capture groups, like $1 or ${room}.
+	Regex  string            `yaml:"regex"`
+	Labels map[string]string `yaml:"labels"`
+
+	re *regexp.Regexp
+}
+
+// labels returns the labels the rule attaches to the device with the given
+// topic, or nil if the topic doesn't match
+func (r *LabelRule) labels(topic string) map[string]string {
+	if r.Regex == "" {
+		if ok, _ := path.Match(r.Topic, topic); !ok {
+			return nil
+		}
+		return r.Labels
+	}
+	if r.re == nil {
+		return nil
+	}
+	match := r.re.FindStringSubmatchIndex(topic)
+	if match == nil {
+		return nil
+	}
+	labels := make(map[string]string, len(r.Labels))
+	for k, v := range r.Labels {
+		labels[k] = string(r.re.ExpandString(nil, v, topic, match))
+	}
+	return labels
+}
+
+// DefaultConfig returns the configuration used when no configuration file
+// is passed
+func DefaultConfig() *Config {
+	return &Config{
+		ListenAddress:      "0.0.0.0:0",
+		StateFlushInterval: 5 * time.Minute,
+	}
+}
+
+// LoadConfig reads and validates the configuration file at path. Values not
+// set in the file keep their default.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := DefaultConfig()
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration for errors. The error refers to the
+// offending key.
+func (c *Config) Validate() error {
+	if c.ListenAddress == "" {
+		return fmt.Errorf("listen_address: must not be empty")
+	}
+	if c.Location.Latitude < -90 || c.Location.Latitude > 90 {
+		return fmt.Errorf("location.lat: %v is not between -90 and 90", c.Location.Latitude)
+	}
+	if c.Location.Longitude < -180 || c.Location.Longitude > 180 {
+		return fmt.Errorf("location.long: %v is not between -180 and 180", c.Location.Longitude)
+	}
+	for i, name := range c.Collectors {
+		if !isCollector(name) {
+			return fmt.Errorf("collectors[%d]: unknown collector %q", i, name)
+		}
+	}
+	for i, l := range c.InfoLabels {
+		if !isInfoLabel(l) {
+			return fmt.Errorf("info_labels[%d]: unknown device info field %q", i, l)
+		}
+		for _, prev := range c.InfoLabels[:i] {
+			if l == prev {
+				return fmt.Errorf("info_labels[%d]: %q is listed more than once", i, l)
+			}
+		}
+	}
+	if c.Staleness.MaxAge < 0 {
+		return fmt.Errorf("staleness.max_age: must not be negative")
+	}
+	for name, d := range c.Staleness.Features {
+		if d < 0 {
+			return fmt.Errorf("staleness.features[%q]: must not be negative", name)
+		}
+	}
+	if err := c.validateVirtual(); err != nil {
+		return err
+	}
+	if err := c.validateGroups(); err != nil {
+		return err
+	}
+	if c.StateFlushInterval < 0 {
+		return fmt.Errorf("state_flush_interval: must not be negative")
+	}
+	if c.Counters.Policy != "" && !c.Counters.Policy.Valid() {
+		return fmt.Errorf("counters.policy: unknown policy %q", c.Counters.Policy)
+	}
+	for name, p := range c.Counters.Features {
+		if !p.Valid() {
+			return fmt.Errorf("counters.features[%q]: unknown policy %q", name, p)
+		}
+	}
+	topics := make([]string, 0, len(c.Devices))
+	for topic := range c.Devices {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		if err := c.validateLabels(c.Devices[topic].Labels); err != nil {
+			return fmt.Errorf("devices[%q].labels: %v", topic, err)
+		}
+	}
+	for i := range c.Labels {
+		r := &c.Labels[i]
+		switch {
+		case r.Topic == "" && r.Regex == "":
+			return fmt.Errorf("labels[%d]: one of topic or regex must be set", i)
+		case r.Topic != "" && r.Regex != "":
+			return fmt.Errorf("labels[%d]: only one of topic or regex can be set", i)
+		case r.Topic != "":
+			if _, err := path.Match(r.Topic, ""); err != nil {
+				return fmt.Errorf("labels[%d].topic: %v", i, err)
+			}
+		default:
+			re, err := regexp.Compile("^(?:" + r.Regex + ")$")
+			if err != nil {
+				return fmt.Errorf("labels[%d].regex: %v", i, err)
+			}
+			r.re = re
+		}
+		if err := c.validateLabels(r.Labels); err != nil {
+			return fmt.Errorf("labels[%d].labels: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// validateVirtual checks the virtual devices and indexes them by the
+// topics of the devices their features are taken from
+func (c *Config) validateVirtual() error {
+	topics := map[string]bool{}
+	for _, v := range c.Virtual {
+		topics[v.Topic] = true
+	}
+	c.sources = map[string][]virtualSource{}
+	for i := range c.Virtual {
+		v := &c.Virtual[i]
+		if v.Topic == "" {
+			return fmt.Errorf("virtual[%d].topic: must not be empty", i)
+		}
+		for _, prev := range c.Virtual[:i] {
+			if v.Topic == prev.Topic {
+				return fmt.Errorf("virtual[%d].topic: %q is used more than once", i, v.Topic)
+			}
+		}
+		if len(v.Features) == 0 {
+			return fmt.Errorf("virtual[%d].features: must not be empty", i)
+		}
+		names := make([]string, 0, len(v.Features))
+		for name := range v.Features {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			src := v.Features[name]
+			switch {
+			case src.Topic == "":
+				return fmt.Errorf("virtual[%d].features[%q].topic: must not be empty", i, name)
+			case topics[src.Topic]:
+				return fmt.Errorf("virtual[%d].features[%q].topic: %q is a virtual device", i, name, src.Topic)
+			}
+			c.sources[src.Topic] = append(c.sources[src.Topic], virtualSource{device: v, feature: name})
+		}
+	}
+	return nil
+}
+
+// validateGroups checks the groups
+func (c *Config) validateGroups() error {
+	labels := map[string]bool{}
+	for _, l := range c.LabelNames() {
+		labels[l] = true
+	}
+	features := map[string]bool{}
+	for _, f := range collectors.GroupFeatures() {
+		features[f] = true
+	}
+	for i, g := range c.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("groups[%d].name: must not be empty", i)
+		}
+		for _, prev := range c.Groups[:i] {
+			if g.Name == prev.Name {
+				return fmt.Errorf("groups[%d].name: %q is used more than once", i, g.Name)
+			}
+		}
+		if _, err := path.Match(g.Topic, ""); err != nil {
+			return fmt.Errorf("groups[%d].topic: %v", i, err)
+		}
+		for k := range g.Labels {
+			if !labels[k] {
+				return fmt.Errorf("groups[%d].labels: label %q is not set by the configuration", i, k)
+			}
+		}
+		for j, f := range g.Features {
+			if !features[f] {
+				return fmt.Errorf("groups[%d].features[%d]: feature %q can't be aggregated", i, j, f)
+			}
+		}
+	}
+	return nil
+}
+
+// LabelNames returns the sorted names of all labels the configuration
+// attaches to metrics, followed by the device info labels
+func (c *Config) LabelNames() []string {
+	seen := map[string]bool{}
+	for _, d := range c.Devices {
+		for k := range d.Labels {
+			seen[k] = true
+		}
+	}
+	for _, r := range c.Labels {
+		for k := range r.Labels {
+			seen[k] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for k := range seen {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return append(names, c.InfoLabels...)
+}
+
+// DeviceLabels returns the labels the configuration attaches to the metrics
+// of the device with the given topic. Later rules win over earlier ones and
+// device overrides win over rules.
+func (c *Config) DeviceLabels(topic string) map[string]string {
+	labels := map[string]string{}
+	for i := range c.Labels {
+		for k, v := range c.Labels[i].labels(topic) {
+			labels[k] = v
+		}
+	}
+	for k, v := range c.Devices[topic].Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// validateLabels checks that all label names are valid and don't collide
+// with labels set by the collectors or copied from the device info
+func (c *Config) validateLabels(labels map[string]string) error {
+	for k := range labels {
+		if !labelNameRE.MatchString(k) || strings.HasPrefix(k, "__") {
+			return fmt.Errorf("invalid label name %q", k)
+		}
+		if reservedLabels[k] {
+			return fmt.Errorf("label name %q is reserved", k)
+		}
+		for _, l := range c.InfoLabels {
+			if k == l {
+				return fmt.Errorf("label name %q is already set from info_labels", k)
+			}
+		}
+	}
+	return nil
+}
+
+// isInfoLabel returns true if name is a device info field that can be used
+// as a label
+func isInfoLabel(name string) bool {
+	for _, l := range collectors.InfoLabels() {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
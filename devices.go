@@ -0,0 +1,174 @@
+package sensorer
+
+import (
+	"path"
+	"time"
+
+	"hemtjan.st/sensorer/collectors"
+	"lib.hemtjan.st/server"
+)
+
+// deviceFilter applies the per-device configuration to the devices of a
+// server.Manager. Ignored devices are hidden, stale values are hidden and
+// the configured labels are attached to the metrics of the others.
+type deviceFilter struct {
+	cfg      *Config
+	names    []string
+	mg       *server.Manager
+	tracker  *collectors.Tracker
+	states   *collectors.StateTracker
+	counters *collectors.CounterTracker
+}
+
+// newDeviceFilter returns a deviceFilter for the devices of mg
+func newDeviceFilter(cfg *Config, mg *server.Manager, t *collectors.Tracker, states *collectors.StateTracker, counters *collectors.CounterTracker) *deviceFilter {
+	return &deviceFilter{
+		cfg:      cfg,
+		names:    cfg.LabelNames(),
+		mg:       mg,
+		tracker:  t,
+		states:   states,
+		counters: counters,
+	}
+}
+
+// Devices returns all devices that aren't ignored, followed by the virtual
+// devices
+func (f *deviceFilter) Devices() []server.Device {
+	devices := f.mg.Devices()
+	stale := f.cfg.Staleness.enabled()
+	res := make([]server.Device, 0, len(devices)+len(f.cfg.Virtual))
+	var byTopic map[string]server.Device
+	if len(f.cfg.Virtual) > 0 {
+		byTopic = make(map[string]server.Device, len(devices))
+	}
+	for _, d := range devices {
+		if byTopic != nil {
+			// Virtual devices can take features from ignored devices
+			byTopic[d.Info().Topic] = d
+		}
+		if f.cfg.Devices[d.Info().Topic].Ignore {
+			continue
+		}
+		if stale {
+			d = &staleDevice{Device: d, f: f}
+		}
+		res = append(res, d)
+	}
+	for i := range f.cfg.Virtual {
+		v := &f.cfg.Virtual[i]
+		if f.cfg.Devices[v.Topic].Ignore {
+			continue
+		}
+		var d server.Device = newVirtualDevice(v, func(topic string) server.Device {
+			return byTopic[topic]
+		})
+		if stale {
+			d = &staleDevice{Device: d, f: f}
+		}
+		res = append(res, d)
+	}
+	return res
+}
+
+// CounterPolicy returns the configured policy of a cumulative feature
+func (f *deviceFilter) CounterPolicy(feature string) collectors.CounterPolicy {
+	return f.cfg.Counters.policy(feature)
+}
+
+// groups returns the configured groups of devices
+func (f *deviceFilter) groups() []collectors.Group {
+	groups := make([]collectors.Group, 0, len(f.cfg.Groups))
+	for _, g := range f.cfg.Groups {
+		g := g
+		groups = append(groups, collectors.Group{
+			Name:     g.Name,
+			Features: g.Features,
+			Match: func(d server.Device) bool {
+				return f.inGroup(g, d)
+			},
+		})
+	}
+	return groups
+}
+
+// inGroup returns true if the device matches the group
+func (f *deviceFilter) inGroup(g Group, d server.Device) bool {
+	if g.Topic != "" {
+		if ok, _ := path.Match(g.Topic, d.Info().Topic); !ok {
+			return false
+		}
+	}
+	if g.Type != "" && g.Type != d.Info().Type {
+		return false
+	}
+	if len(g.Labels) == 0 {
+		return true
+	}
+	values := f.LabelValues(d)
+	for i, n := range f.names {
+		if v, ok := g.Labels[n]; ok && v != values[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// stale returns true if the value of a feature is older than its
+// configured maximum age
+func (f *deviceFilter) stale(topic, feature string) bool {
+	maxAge := f.cfg.Staleness.maxAge(feature)
+	if maxAge <= 0 {
+		return false
+	}
+	t, ok := f.tracker.LastUpdate(topic, feature)
+	if !ok {
+		return false
+	}
+	return time.Since(t) > maxAge
+}
+
+// LabelNames returns the names of the labels set through the configuration
+func (f *deviceFilter) LabelNames() []string {
+	return f.names
+}
+
+// LabelValues returns the configured label values for a device. Labels that
+// don't apply to the device are empty.
+func (f *deviceFilter) LabelValues(d server.Device) []string {
+	labels := f.cfg.DeviceLabels(d.Info().Topic)
+	for _, l := range f.cfg.InfoLabels {
+		labels[l] = collectors.InfoLabelValue(d, l)
+	}
+	values := make([]string, len(f.names))
+	for i, n := range f.names {
+		values[i] = labels[n]
+	}
+	return values
+}
+
+// staleDevice hides the values of features that have not been updated
+// within their maximum age
+type staleDevice struct {
+	server.Device
+	f *deviceFilter
+}
+
+// Feature returns the feature with the given name
+func (d *staleDevice) Feature(name string) server.Feature {
+	ft := d.Device.Feature(name)
+	if d.f.stale(d.Info().Topic, name) {
+		return staleFeature{ft}
+	}
+	return ft
+}
+
+// staleFeature is a feature whose value has expired
+type staleFeature struct {
+	server.Feature
+}
+
+// Value returns an empty value, like for a feature that never got one
+func (staleFeature) Value() string {
+	return ""
+}
@@ -5,5 +5,7 @@ go 1.14
 require (
 	github.com/kelvins/sunrisesunset v0.0.0-20170601204625-14f1915ad4b4
 	github.com/prometheus/client_golang v0.9.3
+	github.com/prometheus/client_model v0.0.0-20190129233127-fd36f4220a90
+	gopkg.in/yaml.v2 v2.4.0
 	lib.hemtjan.st v0.7.0
 )
@@ -0,0 +1,203 @@
+// Package memtransport implements an in-memory transport for a
+// server.Manager, standing in for MQTT
+package memtransport // import "hemtjan.st/sensorer/internal/memtransport"
+
+import (
+	"sync"
+
+	"lib.hemtjan.st/transport/mqtt"
+)
+
+// Transport passes messages between publishers and subscribers in memory.
+// Messages published with retain set are delivered to later subscribers,
+// like an MQTT broker would.
+type Transport struct {
+	mu          sync.Mutex
+	subs        map[string][]*subscriber
+	retained    map[string][]byte
+	deviceState chan *mqtt.DeviceState
+	discover    chan struct{}
+}
+
+// New returns an empty transport
+func New() *Transport {
+	return &Transport{
+		subs:        map[string][]*subscriber{},
+		retained:    map[string][]byte{},
+		deviceState: make(chan *mqtt.DeviceState, 64),
+		discover:    make(chan struct{}, 1),
+	}
+}
+
+// Announce sends a device announcement to the manager
+func (t *Transport) Announce(topic string, payload []byte) {
+	t.deviceState <- &mqtt.DeviceState{
+		Topic:   topic,
+		Type:    mqtt.TypeAnnounce,
+		Payload: payload,
+	}
+}
+
+// Leave tells the manager a device is gone
+func (t *Transport) Leave(topic string) {
+	t.deviceState <- &mqtt.DeviceState{
+		Topic: topic,
+		Type:  mqtt.TypeLeave,
+	}
+}
+
+// DeviceState returns the channel announcements are sent on
+func (t *Transport) DeviceState() chan *mqtt.DeviceState {
+	return t.deviceState
+}
+
+// Discover returns a channel that is never written to, there is nobody to
+// announce devices again
+func (t *Transport) Discover() chan struct{} {
+	return t.discover
+}
+
+// PublishMeta publishes a retained message
+func (t *Transport) PublishMeta(topic string, payload []byte) {
+	t.Publish(topic, payload, true)
+}
+
+// Publish queues a message for all subscribers of the topic. It doesn't
+// wait for the subscribers to receive it.
+func (t *Transport) Publish(topic string, payload []byte, retain bool) {
+	t.mu.Lock()
+	if retain {
+		t.retained[topic] = payload
+	}
+	subs := append([]*subscriber(nil), t.subs[topic]...)
+	t.mu.Unlock()
+	for _, s := range subs {
+		s.push(payload)
+	}
+}
+
+// Subscribe returns a channel receiving the messages published on topic,
+// starting with the retained message if there is one
+func (t *Transport) Subscribe(topic string) chan []byte {
+	s := newSubscriber()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.subs[topic] = append(t.subs[topic], s)
+	if p, ok := t.retained[topic]; ok {
+		s.push(p)
+	}
+	return s.ch
+}
+
+// SubscribeRaw is the same as Subscribe
+func (t *Transport) SubscribeRaw(topic string) chan []byte {
+	return t.Subscribe(topic)
+}
+
+// Resubscribe moves the subscribers of oldTopic to newTopic
+func (t *Transport) Resubscribe(oldTopic, newTopic string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	subs, ok := t.subs[oldTopic]
+	if !ok {
+		return false
+	}
+	delete(t.subs, oldTopic)
+	t.subs[newTopic] = append(t.subs[newTopic], subs...)
+	return true
+}
+
+// Unsubscribe closes the channels of all subscribers of topic
+func (t *Transport) Unsubscribe(topic string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	subs, ok := t.subs[topic]
+	if !ok {
+		return false
+	}
+	delete(t.subs, topic)
+	for _, s := range subs {
+		s.close()
+	}
+	return true
+}
+
+// LastWillID returns the ID devices use for their last will
+func (t *Transport) LastWillID() string {
+	return "memtransport"
+}
+
+// subscriber queues the messages for one subscription, so that publishing
+// never waits for a subscriber that is slow to receive them
+type subscriber struct {
+	ch    chan []byte
+	ready chan struct{}
+	done  chan struct{}
+
+	mu     sync.Mutex
+	queue  [][]byte
+	closed bool
+}
+
+// newSubscriber returns a subscriber delivering its queue on ch until it is
+// closed
+func newSubscriber() *subscriber {
+	s := &subscriber{
+		ch:    make(chan []byte),
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// push adds a message to the queue
+func (s *subscriber) push(p []byte) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.queue = append(s.queue, p)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the delivery and closes the channel. Queued messages are
+// dropped.
+func (s *subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+// run delivers the queued messages in order
+func (s *subscriber) run() {
+	defer close(s.ch)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.ready:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		p := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		select {
+		case s.ch <- p:
+		case <-s.done:
+			return
+		}
+	}
+}
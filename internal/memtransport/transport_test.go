@@ -0,0 +1,64 @@
+package memtransport
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPublishDoesNotBlock(t *testing.T) {
+	tr := New()
+	ch := tr.Subscribe("a")
+
+	// Nobody is receiving, publishing and unsubscribing must still return
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			tr.Publish("a", []byte(fmt.Sprint(i)), false)
+		}
+		tr.Subscribe("b")
+		tr.Unsubscribe("a")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out publishing to a subscriber that isn't receiving")
+	}
+	for range ch {
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	tr := New()
+	tr.Publish("a", []byte("retained"), true)
+	ch := tr.Subscribe("a")
+	for i := 0; i < 20; i++ {
+		tr.Publish("a", []byte(fmt.Sprint(i)), false)
+	}
+
+	expected := []string{"retained"}
+	for i := 0; i < 20; i++ {
+		expected = append(expected, fmt.Sprint(i))
+	}
+	for _, e := range expected {
+		select {
+		case p := <-ch:
+			if string(p) != e {
+				t.Fatalf("received %q, expected %q", p, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", e)
+		}
+	}
+
+	tr.Unsubscribe("a")
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("received a message after unsubscribing")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("channel not closed after unsubscribing")
+	}
+}
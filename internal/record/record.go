@@ -0,0 +1,177 @@
+// Package record records the messages a server.Manager receives and
+// replays them later, so what the exporter saw can be reproduced without
+// the MQTT broker
+package record // import "hemtjan.st/sensorer/internal/record"
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"hemtjan.st/sensorer/internal/memtransport"
+	"lib.hemtjan.st/server"
+	"lib.hemtjan.st/transport/mqtt"
+)
+
+// Kinds of recorded messages
+const (
+	KindAnnounce = "a"
+	KindLeave    = "l"
+	KindMessage  = "m"
+)
+
+// Entry is a recorded message. Entries are stored as one JSON object per
+// line.
+type Entry struct {
+	// Time is the time the message was received in milliseconds since
+	// the Unix epoch
+	Time    int64  `json:"t"`
+	Kind    string `json:"k"`
+	Topic   string `json:"topic"`
+	Payload string `json:"p,omitempty"`
+}
+
+// Writer writes entries to an underlying writer. It is safe for concurrent
+// use.
+type Writer struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewWriter returns a Writer writing to w
+func NewWriter(w io.Writer) *Writer {
+	bw := bufio.NewWriter(w)
+	return &Writer{
+		w:   bw,
+		enc: json.NewEncoder(bw),
+	}
+}
+
+// Write records a message received now
+func (w *Writer) Write(kind, topic string, payload []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(&Entry{
+		Time:    time.Now().UnixNano() / int64(time.Millisecond),
+		Kind:    kind,
+		Topic:   topic,
+		Payload: string(payload),
+	})
+}
+
+// Flush writes buffered entries to the underlying writer
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Flush()
+}
+
+// Transport wraps the transport of a server.Manager and records all device
+// announcements and feature values passing through it
+type Transport struct {
+	server.Transport
+	w           *Writer
+	deviceState chan *mqtt.DeviceState
+}
+
+// NewTransport returns a transport recording the messages of t into w
+func NewTransport(t server.Transport, w *Writer) *Transport {
+	rt := &Transport{
+		Transport:   t,
+		w:           w,
+		deviceState: make(chan *mqtt.DeviceState),
+	}
+	go rt.recordDeviceState(t.DeviceState())
+	return rt
+}
+
+// recordDeviceState records and forwards announcements
+func (t *Transport) recordDeviceState(in chan *mqtt.DeviceState) {
+	defer close(t.deviceState)
+	for ds := range in {
+		var err error
+		switch ds.Type {
+		case mqtt.TypeAnnounce:
+			err = t.w.Write(KindAnnounce, ds.Topic, ds.Payload)
+		case mqtt.TypeLeave:
+			err = t.w.Write(KindLeave, ds.Topic, nil)
+		}
+		if err != nil {
+			log.Printf("recording %s: %v", ds.Topic, err)
+		}
+		t.deviceState <- ds
+	}
+}
+
+// DeviceState returns the channel announcements are sent on
+func (t *Transport) DeviceState() chan *mqtt.DeviceState {
+	return t.deviceState
+}
+
+// Subscribe returns a channel receiving the messages published on topic
+func (t *Transport) Subscribe(topic string) chan []byte {
+	return t.record(topic, t.Transport.Subscribe(topic))
+}
+
+// SubscribeRaw returns a channel receiving the messages published on topic
+func (t *Transport) SubscribeRaw(topic string) chan []byte {
+	return t.record(topic, t.Transport.SubscribeRaw(topic))
+}
+
+// record records and forwards the messages of a subscription
+func (t *Transport) record(topic string, in chan []byte) chan []byte {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for p := range in {
+			if err := t.w.Write(KindMessage, topic, p); err != nil {
+				log.Printf("recording %s: %v", topic, err)
+			}
+			out <- p
+		}
+	}()
+	return out
+}
+
+// Replay feeds the entries read from r into t. The time between entries is
+// divided by speed; with a speed of 0 entries are replayed without delay.
+// Replay returns when all entries are replayed or ctx is cancelled.
+func Replay(ctx context.Context, r io.Reader, t *memtransport.Transport, speed float64) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var last int64
+	for line := 1; ; line++ {
+		var e Entry
+		if err := dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("entry %d: %v", line, err)
+		}
+
+		if last != 0 && speed > 0 && e.Time > last {
+			d := time.Duration(float64(time.Duration(e.Time-last)*time.Millisecond) / speed)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d):
+			}
+		}
+		last = e.Time
+
+		switch e.Kind {
+		case KindAnnounce:
+			t.Announce(e.Topic, []byte(e.Payload))
+		case KindLeave:
+			t.Leave(e.Topic)
+		case KindMessage:
+			t.Publish(e.Topic, []byte(e.Payload), true)
+		default:
+			return fmt.Errorf("entry %d: unknown kind %q", line, e.Kind)
+		}
+	}
+}
@@ -2,21 +2,101 @@ package sensorer // import "hemtjan.st/sensorer"
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 
 	"hemtjan.st/sensorer/collectors"
 	"lib.hemtjan.st/server"
 )
 
-var (
-	latitude  float64
-	longitude float64
-)
+// sensorCollector is a collector that can be enabled in the configuration
+type sensorCollector struct {
+	name string
+	new  func(d *deviceFilter) (prometheus.Collector, error)
+}
+
+// sensorCollectors are all collectors, in the order they are registered
+var sensorCollectors = []sensorCollector{
+	{"battery", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewBatteryCollector(d)
+	}},
+	{"contact", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewContactCollector(d, d.states)
+	}},
+	{"safety", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewSafetyCollector(d, d.states)
+	}},
+	{"light", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewLightCollector(d, d.states)
+	}},
+	{"position", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewPositionCollector(d)
+	}},
+	{"power", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewPowerCollector(d, d.counters)
+	}},
+	{"utility", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewUtilityMeterCollector(d, d.counters)
+	}},
+	{"environmental", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewEnvironmentalCollector(d, d.cfg.Location.Latitude, d.cfg.Location.Longitude)
+	}},
+	{"climate", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewClimateCollector(d)
+	}},
+	{"airquality", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewAirQualityCollector(d)
+	}},
+	{"link", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewLinkCollector(d)
+	}},
+	{"counter", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewCounterCollector(d, d.counters)
+	}},
+	{"filter", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewFilterCollector(d)
+	}},
+	{"group", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewGroupCollector(d, d.groups())
+	}},
+	{"info", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewDeviceInfoCollector(d)
+	}},
+	{"update", func(d *deviceFilter) (prometheus.Collector, error) {
+		return collectors.NewUpdateCollector(d, d.tracker)
+	}},
+}
+
+// isCollector returns true if there is a collector with the given name
+func isCollector(name string) bool {
+	for _, c := range sensorCollectors {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enabled returns true if the collector with the given name is enabled
+func (c *Config) enabled(name string) bool {
+	if len(c.Collectors) == 0 {
+		return true
+	}
+	for _, n := range c.Collectors {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
 
 // NewPrometheusMetrics returns a Prometheus registry with metrics that
 // instrument the exporter itself
@@ -29,72 +109,215 @@ func NewPrometheusMetrics() *prometheus.Registry {
 
 // NewSensorMetrics returns a Prometheus registry with sensor related
 // collectors
-func NewSensorMetrics(mg *server.Manager) (*prometheus.Registry, error) {
+func NewSensorMetrics(cfg *Config, mg *server.Manager, t *collectors.Tracker, states *collectors.StateTracker, counters *collectors.CounterTracker) (*prometheus.Registry, error) {
 	p := prometheus.NewPedanticRegistry()
-	c, err := collectors.NewBatteryCollector(mg)
-	if err != nil {
-		return nil, err
+	devices := newDeviceFilter(cfg, mg, t, states, counters)
+	for _, sc := range sensorCollectors {
+		if !cfg.enabled(sc.name) {
+			continue
+		}
+		c, err := sc.new(devices)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Register(c); err != nil {
+			return nil, fmt.Errorf("collector %s: %v", sc.name, err)
+		}
 	}
-	p.MustRegister(c)
+	return p, nil
+}
 
-	c, err = collectors.NewContactCollector(mg)
-	if err != nil {
-		return nil, err
-	}
-	p.MustRegister(c)
+// ConfigLoader returns the current configuration of the exporter
+type ConfigLoader func() (*Config, error)
 
-	c, err = collectors.NewPowerCollector(mg)
-	if err != nil {
-		return nil, err
-	}
-	p.MustRegister(c)
+// Server exposes the Prometheus metrics over HTTP
+type Server struct {
+	mu      sync.RWMutex
+	cfg     *Config
+	sensors *prometheus.Registry
 
-	c, err = collectors.NewEnvironmentalCollector(mg, latitude, longitude)
-	if err != nil {
-		return nil, err
-	}
-	p.MustRegister(c)
+	reloadMu          sync.Mutex
+	load              ConfigLoader
+	lastReloadSuccess prometheus.Gauge
+	mg                *server.Manager
+	tracker           *collectors.Tracker
+	states            *collectors.StateTracker
+	counters          *collectors.CounterTracker
+	http              *http.Server
+	cancel            context.CancelFunc
+}
 
-	c, err = collectors.NewFilterCollector(mg)
+// NewServer starts an HTTP server exposing Prometheus metrics. The load
+// function is called to read the configuration again when the server is
+// reloaded.
+func NewServer(cfg *Config, load ConfigLoader, mg *server.Manager) (*Server, error) {
+	listener, err := net.Listen("tcp", cfg.ListenAddress)
 	if err != nil {
 		return nil, err
 	}
-	p.MustRegister(c)
-	return p, nil
-}
-
-// NewServer starts an HTTP server exposing Prometheus metrics
-func NewServer(addr string, lat, long float64, mg *server.Manager) (func(context.Context), error) {
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
+	tracker := collectors.NewTracker(mg)
+	states := collectors.NewStateTracker(tracker)
+	counters := collectors.NewCounterTracker(tracker)
+	if err := loadState(cfg.StateFile, counters, states); err != nil {
 		return nil, err
 	}
-	latitude = lat
-	longitude = long
-	sensors, err := NewSensorMetrics(mg)
+	sensors, err := NewSensorMetrics(cfg, mg, tracker, states, counters)
 	if err != nil {
 		return nil, err
 	}
 	promMetrics := NewPrometheusMetrics()
 	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	s := &Server{
+		cfg:     cfg,
+		sensors: sensors,
+		load:    load,
+		lastReloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "sensorer",
+			Subsystem: "config",
+			Name:      "last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful",
+		}),
+		mg:       mg,
+		tracker:  tracker,
+		states:   states,
+		counters: counters,
+		cancel:   ctxCancel,
+	}
+	s.lastReloadSuccess.Set(1)
+	promMetrics.MustRegister(s.lastReloadSuccess)
+	tracker.OnUpdate(s.forwardVirtual)
 	go mg.Start(ctx)
+	go tracker.Start(ctx, time.Second)
+	go s.flushState(ctx)
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.HandlerFor(promMetrics, promhttp.HandlerOpts{}))
-	mux.Handle("/sensors", promhttp.InstrumentMetricHandler(promMetrics, promhttp.HandlerFor(sensors, promhttp.HandlerOpts{})))
-	h := &http.Server{
+	mux.Handle("/sensors", promhttp.InstrumentMetricHandler(promMetrics, promhttp.HandlerFor(prometheus.GathererFunc(s.gather), promhttp.HandlerOpts{})))
+	mux.HandleFunc("/-/reload", s.handleReload)
+	s.http = &http.Server{
 		Handler: mux,
 	}
 	go func() {
-		if err := h.Serve(listener); err != http.ErrServerClosed {
+		if err := s.http.Serve(listener); err != http.ErrServerClosed {
 			log.Fatal(err.Error())
 		}
 	}()
 
 	log.Printf("exporter listening on: %s", listener.Addr().String())
 
-	return func(ctx context.Context) {
-		ctxCancel()
-		h.Shutdown(ctx)
-	}, nil
+	return s, nil
+}
+
+// gather collects the sensor metrics from the current registry
+func (s *Server) gather() ([]*dto.MetricFamily, error) {
+	s.mu.RLock()
+	sensors := s.sensors
+	s.mu.RUnlock()
+	return sensors.Gather()
+}
+
+// Reload reads the configuration again and swaps the sensor collectors for
+// ones using the new configuration. The connection to MQTT and the devices
+// known to the manager are kept. The listen address can't be changed
+// without a restart.
+func (s *Server) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	err := s.reload()
+	if err != nil {
+		s.lastReloadSuccess.Set(0)
+		return err
+	}
+	s.lastReloadSuccess.Set(1)
+	return nil
+}
+
+func (s *Server) reload() error {
+	cfg, err := s.load()
+	if err != nil {
+		return err
+	}
+	sensors, err := NewSensorMetrics(cfg, s.mg, s.tracker, s.states, s.counters)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if cfg.ListenAddress != s.cfg.ListenAddress {
+		log.Printf("listen address changed to %s, restart the exporter to apply it", cfg.ListenAddress)
+	}
+	s.cfg = cfg
+	s.sensors = sensors
+	s.mu.Unlock()
+	return nil
+}
+
+// handleReload reloads the configuration on a POST request
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.Reload(); err != nil {
+		log.Printf("reloading configuration failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Print("reloaded configuration")
+}
+
+// Shutdown stops the HTTP server and the manager and saves the state of
+// the exporter
+func (s *Server) Shutdown(ctx context.Context) {
+	s.cancel()
+	s.http.Shutdown(ctx)
+	s.saveState()
+}
+
+// forwardVirtual passes an update of a feature on to the features of
+// virtual devices taken from it
+func (s *Server) forwardVirtual(d server.Device, feature, value string, t time.Time) {
+	s.mu.RLock()
+	virtual := s.cfg.virtualFeatures(d.Info().Topic, feature)
+	s.mu.RUnlock()
+	for _, v := range virtual {
+		s.tracker.Update(newVirtualDevice(v.device, s.mg.Device), v.feature, value)
+	}
+}
+
+// flushState saves the state of the exporter every flush interval until
+// the context is cancelled. The interval is read from the current
+// configuration before every flush.
+func (s *Server) flushState(ctx context.Context) {
+	for {
+		s.mu.RLock()
+		interval := s.cfg.StateFlushInterval
+		s.mu.RUnlock()
+		flush := interval > 0
+		if !flush {
+			// Check again later, the interval may be set by a reload
+			interval = time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if flush {
+			s.saveState()
+		}
+	}
+}
+
+// saveState saves the state of the exporter to the configured state file
+func (s *Server) saveState() {
+	s.mu.RLock()
+	path := s.cfg.StateFile
+	s.mu.RUnlock()
+	if err := saveState(path, s.counters, s.states); err != nil {
+		log.Printf("saving state: %v", err)
+	}
 }
@@ -0,0 +1,103 @@
+package sensorer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"hemtjan.st/sensorer/collectors"
+)
+
+// stateVersion is the version of the state file format. Version 0 is the
+// bare list of counters written before the state file held anything else.
+const stateVersion = 1
+
+// stateFile is the state the exporter keeps across restarts
+type stateFile struct {
+	Version  int                        `json:"version"`
+	Counters *collectors.CounterTracker `json:"counters"`
+	States   *collectors.StateTracker   `json:"states"`
+}
+
+// loadState restores the state saved at path into the trackers. A missing
+// file is not an error.
+func loadState(path string, counters *collectors.CounterTracker, states *collectors.StateTracker) error {
+	if path == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := decodeState(b, counters, states); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// decodeState restores the state in b, migrating it from older versions
+func decodeState(b []byte, counters *collectors.CounterTracker, states *collectors.StateTracker) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		// Version 0
+		return json.Unmarshal(b, counters)
+	}
+	var v struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.Version > stateVersion {
+		return fmt.Errorf("unsupported version %d, the newest known is %d", v.Version, stateVersion)
+	}
+	return json.Unmarshal(b, &stateFile{
+		Version:  v.Version,
+		Counters: counters,
+		States:   states,
+	})
+}
+
+// saveState writes the state of the trackers to path. The file is replaced
+// atomically, so it is never left half written.
+func saveState(path string, counters *collectors.CounterTracker, states *collectors.StateTracker) error {
+	if path == "" {
+		return nil
+	}
+	b, err := json.Marshal(&stateFile{
+		Version:  stateVersion,
+		Counters: counters,
+		States:   states,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
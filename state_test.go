@@ -0,0 +1,46 @@
+package sensorer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"hemtjan.st/sensorer/collectors"
+)
+
+func TestDecodeState(t *testing.T) {
+	counters := `[{"topic":"power/meter","feature":"energyUsed","last":10,"offset":150,"highest":150,"resets":1}]`
+	tests := []struct {
+		name  string
+		state string
+		err   bool
+	}{
+		{"version 0", counters, false},
+		{"version 0 with whitespace", "\n  " + counters + "\n", false},
+		{"version 1", `{"version":1,"counters":` + counters + `,"states":[]}`, false},
+		{"newer version", `{"version":2,"counters":` + counters + `}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := collectors.NewTracker(nil)
+			c := collectors.NewCounterTracker(tr)
+			s := collectors.NewStateTracker(tr)
+			err := decodeState([]byte(tt.state), c, s)
+			if tt.err {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != counters {
+				t.Errorf("restored counters %s, expected %s", b, counters)
+			}
+		})
+	}
+}
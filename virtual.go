@@ -0,0 +1,111 @@
+package sensorer
+
+import (
+	"errors"
+
+	"lib.hemtjan.st/device"
+	"lib.hemtjan.st/feature"
+	"lib.hemtjan.st/server"
+)
+
+// errVirtualFeature is returned when a virtual feature is written to or
+// subscribed to
+var errVirtualFeature = errors.New("virtual features are read-only")
+
+// virtualDevice is a device defined in the configuration whose features are
+// taken from other devices
+type virtualDevice struct {
+	cfg  *VirtualDevice
+	info *device.Info
+	// source returns the device with the given topic, or nil
+	source func(topic string) server.Device
+}
+
+// newVirtualDevice returns the device defined by cfg, looking up the
+// devices its features are taken from with source
+func newVirtualDevice(cfg *VirtualDevice, source func(topic string) server.Device) *virtualDevice {
+	features := make(map[string]*feature.Info, len(cfg.Features))
+	for name := range cfg.Features {
+		features[name] = &feature.Info{}
+	}
+	return &virtualDevice{
+		cfg: cfg,
+		info: &device.Info{
+			Topic:     cfg.Topic,
+			Name:      cfg.Name,
+			Type:      cfg.Type,
+			Features:  features,
+			Reachable: true,
+		},
+		source: source,
+	}
+}
+
+func (d *virtualDevice) Id() string           { return d.info.Topic }
+func (d *virtualDevice) Name() string         { return d.info.Name }
+func (d *virtualDevice) Manufacturer() string { return d.info.Manufacturer }
+func (d *virtualDevice) Model() string        { return d.info.Model }
+func (d *virtualDevice) SerialNumber() string { return d.info.SerialNumber }
+func (d *virtualDevice) Type() string         { return d.info.Type }
+func (d *virtualDevice) Info() *device.Info   { return d.info }
+func (d *virtualDevice) Exists() bool         { return true }
+func (d *virtualDevice) IsReachable() bool    { return true }
+
+// Feature returns the feature with the given name, as found on the device
+// it is taken from
+func (d *virtualDevice) Feature(name string) server.Feature {
+	src, ok := d.cfg.Features[name]
+	if !ok {
+		return missingFeature(name)
+	}
+	s := d.source(src.Topic)
+	if s == nil {
+		return missingFeature(name)
+	}
+	ft := s.Feature(src.feature(name))
+	if !ft.Exists() {
+		return missingFeature(name)
+	}
+	return virtualFeature{Feature: ft, name: name}
+}
+
+// Features returns all features of the device
+func (d *virtualDevice) Features() []server.Feature {
+	features := make([]server.Feature, 0, len(d.cfg.Features))
+	for name := range d.cfg.Features {
+		features = append(features, d.Feature(name))
+	}
+	return features
+}
+
+// virtualFeature is a feature of another device, under the name it has on
+// a virtual device
+type virtualFeature struct {
+	server.Feature
+	name string
+}
+
+// Name returns the name of the feature on the virtual device
+func (f virtualFeature) Name() string { return f.name }
+
+// Update fails, virtual features are read-only
+func (virtualFeature) Update(string) error { return errVirtualFeature }
+
+// OnUpdate fails, updates of virtual features are forwarded by the Tracker
+func (virtualFeature) OnUpdate() (chan string, error) { return nil, errVirtualFeature }
+
+// OnUpdateFunc fails, updates of virtual features are forwarded by the
+// Tracker
+func (virtualFeature) OnUpdateFunc(func(string)) error { return errVirtualFeature }
+
+// missingFeature is a feature of a virtual device whose device doesn't
+// exist (yet)
+type missingFeature string
+
+func (f missingFeature) Name() string                  { return string(f) }
+func (missingFeature) Info() *feature.Info             { return &feature.Info{} }
+func (missingFeature) Exists() bool                    { return false }
+func (missingFeature) Value() string                   { return "" }
+func (missingFeature) Update(string) error             { return errVirtualFeature }
+func (missingFeature) OnUpdate() (chan string, error)  { return nil, errVirtualFeature }
+func (missingFeature) OnUpdateFunc(func(string)) error { return errVirtualFeature }